@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"golang/app-cli/cmd/common"
+	"golang/app-cli/cmd/common/resource"
+)
+
+var (
+	manifests []string
+	dryRun    bool
+	prune     bool
+)
+
+// kinds the resources a manifest can declare, by kind
+var kinds = map[string]*resource.Definition{
+	resourceA.Name: resourceA,
+	resourceB.Name: resourceB,
+}
+
+// applyCmd create or update the resources declared in the manifests
+var applyCmd = &cobra.Command{
+	Use:   "apply -f FILE|DIR|-",
+	Short: "Create or update resources from YAML/JSON manifests",
+	Long: `Create or update the resources declared in YAML/JSON manifests, a file
+holds one or more documents separated by "---", eg:
+
+  kind: resourceA
+  name: web
+  description: the front
+  ---
+  kind: resourceB
+  name: disk
+  resource_a_id: 5f2b...
+  size: 10
+
+A resource is matched to the server one by its id if given, by its name
+otherwise. With --prune, the resources of the same kinds missing from the
+manifests are deleted.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(manifests) == 0 {
+			return errors.New("no manifest, set -f FILE, DIR or - for stdin")
+		}
+
+		var objs []resource.Object
+		for _, path := range manifests {
+			o, err := resource.ReadManifests(path, os.Stdin)
+			if err != nil {
+				return err
+			}
+			objs = append(objs, o...)
+		}
+
+		changes, err := resource.Plan(objs, kinds, prune)
+		if err != nil {
+			return err
+		}
+
+		out := common.GlobalFlag.Out()
+		if dryRun {
+			for _, c := range changes {
+				if c.Action != resource.Unchanged {
+					fmt.Fprintln(out, c)
+				}
+			}
+			fmt.Fprintf(out, "%s (dry run)\n", resource.Count(changes))
+			return nil
+		}
+
+		summary, err := resource.Apply(changes, func(c *resource.Change) {
+			if c.Action != resource.Unchanged {
+				fmt.Fprintln(out, c)
+			}
+		})
+		fmt.Fprintln(out, summary)
+		return err
+	},
+}
+
+func init() {
+	applyCmd.Flags().StringSliceVarP(&manifests, "filename", "f", nil, "the manifest file or directory, - reads stdin, can be repeated")
+	applyCmd.Flags().BoolVar(&dryRun, "dry-run", false, "print the planned changes without making them")
+	applyCmd.Flags().BoolVar(&prune, "prune", false, "delete the resources of the manifests' kinds missing from them")
+	RootCmd.AddCommand(applyCmd)
+}
@@ -0,0 +1,144 @@
+package apierror
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// RequestIDHeader the header of the request id, to give to the operators
+const RequestIDHeader = "X-Openstack-Request-Id"
+
+// maxRawMessage how much of a body in no known shape is kept as the message
+const maxRawMessage = 300
+
+// APIError an api request answered with an unexpected status
+type APIError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	// RequestID the X-Openstack-Request-Id of the response, if any
+	RequestID string
+	// Message the error message parsed from the body
+	Message string
+	// Retryable the same request may succeed later, eg: 429 or 503
+	Retryable bool
+	Body      []byte
+}
+
+// New use to new the error of the response status, headers and body
+func New(method, url string, statusCode int, headers http.Header, body []byte) *APIError {
+	requestID := headers.Get(RequestIDHeader)
+	if requestID == "" {
+		// some services only send the compute style one
+		requestID = headers.Get("X-Compute-Request-Id")
+	}
+
+	return &APIError{
+		Method:     method,
+		URL:        url,
+		StatusCode: statusCode,
+		RequestID:  requestID,
+		Message:    ParseMessage(body),
+		Retryable:  Retryable(statusCode),
+		Body:       body,
+	}
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.RequestID != "" {
+		msg += " (request id " + e.RequestID + ")"
+	}
+	return msg
+}
+
+// Retryable the status tells the same request may succeed later
+func Retryable(statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// ParseMessage find the message in the common error shapes:
+//
+//	{"error": {"message": "..."}}              keystone
+//	{"itemNotFound": {"message": "..."}}       nova, cinder
+//	{"NeutronError": {"message": "..."}}       neutron
+//	{"errors": [{"title": "", "detail": ""}]}  the api-wg guideline
+//	{"error_message": "{\"faultstring\": ""}"} ironic
+//	{"message": "..."}, {"error": "..."}, {"faultstring": "..."}, {"detail": "..."}
+//
+// the body is returned trimmed if it's in none of them
+func ParseMessage(body []byte) string {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return raw(body)
+	}
+	if msg := message(doc); msg != "" {
+		return msg
+	}
+	return raw(body)
+}
+
+func message(doc interface{}) string {
+	switch v := doc.(type) {
+	case string:
+		// ironic wraps a json document in a string
+		var inner interface{}
+		if err := json.Unmarshal([]byte(v), &inner); err == nil {
+			if msg := message(inner); msg != "" {
+				return msg
+			}
+		}
+		return strings.TrimSpace(v)
+
+	case []interface{}:
+		var msgs []string
+		for _, e := range v {
+			if msg := message(e); msg != "" {
+				msgs = append(msgs, msg)
+			}
+		}
+		return strings.Join(msgs, "; ")
+
+	case map[string]interface{}:
+		for _, k := range []string{"message", "faultstring", "error_message", "detail", "error", "errors"} {
+			if e, ok := v[k]; ok {
+				if msg := message(e); msg != "" {
+					if title, ok := v["title"].(string); ok && k == "detail" && title != "" {
+						return title + ": " + msg
+					}
+					return msg
+				}
+			}
+		}
+		if title, ok := v["title"].(string); ok {
+			return title
+		}
+		// the nova style {"<faultName>": {"message": ...}}
+		if len(v) == 1 {
+			for _, e := range v {
+				if _, ok := e.(map[string]interface{}); ok {
+					return message(e)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func raw(body []byte) string {
+	msg := strings.TrimSpace(string(body))
+	if len(msg) > maxRawMessage {
+		msg = msg[:maxRawMessage] + "..."
+	}
+	return msg
+}
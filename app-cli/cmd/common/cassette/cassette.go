@@ -0,0 +1,245 @@
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang/app-cli/cmd/common/trace"
+)
+
+// Version the version of the cassette format
+const Version = 1
+
+// Cassette the requests and responses of a run, the tokens and
+// secrets are redacted as --debug does
+type Cassette struct {
+	Version      int           `json:"version"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction a request and the response it got
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Request struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Load read the cassette file
+func Load(path string) (*Cassette, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cassette{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %s", path, err)
+	}
+	if c.Version != Version {
+		return nil, fmt.Errorf("invalid cassette %s: version %d, want %d", path, c.Version, Version)
+	}
+	return c, nil
+}
+
+// Identity the auth url and identity api version the cassette was recorded
+// with, from its first request: the version discovery at the auth url, or
+// the token request when the version was given
+func (c *Cassette) Identity() (authURL, version string) {
+	if len(c.Interactions) == 0 {
+		return "", ""
+	}
+
+	r := c.Interactions[0].Request
+	if r.Method == http.MethodPost {
+		switch {
+		case strings.HasSuffix(r.URL, "/auth/tokens"):
+			return strings.TrimSuffix(r.URL, "/auth/tokens"), "3"
+		case strings.HasSuffix(r.URL, "/tokens"):
+			return strings.TrimSuffix(r.URL, "/tokens"), "2.0"
+		}
+	}
+	return r.URL, ""
+}
+
+// Save write the cassette file
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0600)
+}
+
+func redactHeaders(h http.Header) http.Header {
+	if len(h) == 0 {
+		return nil
+	}
+	redacted := http.Header{}
+	for k, values := range h {
+		for _, v := range values {
+			redacted.Add(k, trace.RedactHeader(k, v))
+		}
+	}
+	return redacted
+}
+
+// Recorder a transport saving every request and its response to the
+// cassette file, the file is written after each one so an interrupted
+// run keeps what it got
+type Recorder struct {
+	Base http.RoundTripper
+	Path string
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecorder use to new a recorder over base, the cassette file is
+// created empty at once
+func NewRecorder(base http.RoundTripper, path string) (*Recorder, error) {
+	r := &Recorder{Base: base, Path: path, cassette: Cassette{Version: Version, Interactions: []Interaction{}}}
+	if err := r.cassette.Save(path); err != nil {
+		return nil, fmt.Errorf("create the cassette: %s", err)
+	}
+	return r, nil
+}
+
+// RoundTrip send the request by the base transport and record it
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := trace.ReadBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := trace.ReadBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	i := Interaction{
+		Request: Request{
+			Method:  req.Method,
+			URL:     req.URL.String(),
+			Headers: redactHeaders(req.Header),
+			Body:    string(trace.RedactBody(reqBody)),
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Headers:    redactHeaders(resp.Header),
+			Body:       string(trace.RedactBody(respBody)),
+		},
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, i)
+	if err := r.cassette.Save(r.Path); err != nil {
+		return nil, fmt.Errorf("record the cassette: %s", err)
+	}
+	return resp, nil
+}
+
+// Player a transport answering the requests from a cassette, without
+// touching the network. A request gets the first response recorded for
+// the same method, path and query that is not replayed yet, the host is
+// ignored so the cassette replays against any --os-auth-url. Once they
+// are all replayed, the last one is replayed again, eg: for the polling
+type Player struct {
+	Cassette *Cassette
+
+	mu       sync.Mutex
+	replayed []bool
+}
+
+// NewPlayer use to new a player of the cassette
+func NewPlayer(c *Cassette) *Player {
+	return &Player{Cassette: c, replayed: make([]bool, len(c.Interactions))}
+}
+
+// RoundTrip answer the request with the recorded response
+func (p *Player) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, err := trace.ReadBody(&req.Body); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	found := -1
+	for i, in := range p.Cassette.Interactions {
+		if in.Request.Method != req.Method || !sameURL(in.Request.URL, req.URL) {
+			continue
+		}
+		found = i
+		if !p.replayed[i] {
+			break
+		}
+	}
+	if found < 0 {
+		return nil, fmt.Errorf("the cassette has no response to %s %s", req.Method, req.URL)
+	}
+	p.replayed[found] = true
+
+	recorded := p.Cassette.Interactions[found].Response
+	header := http.Header{}
+	for k, v := range recorded.Headers {
+		header[k] = append([]string(nil), v...)
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(recorded.StatusCode) + " " + http.StatusText(recorded.StatusCode),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader([]byte(recorded.Body))),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}, nil
+}
+
+// Unused the requests of the cassette that were not replayed, a test
+// may check the code sent all it's expected to
+func (p *Player) Unused() []Request {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var unused []Request
+	for i, in := range p.Cassette.Interactions {
+		if !p.replayed[i] {
+			unused = append(unused, in.Request)
+		}
+	}
+	return unused
+}
+
+func sameURL(recorded string, u *url.URL) bool {
+	r, err := url.Parse(recorded)
+	if err != nil {
+		return false
+	}
+	return r.Path == u.Path && r.Query().Encode() == u.Query().Encode()
+}
@@ -0,0 +1,159 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type service struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Enabled     bool   `json:"enabled"`
+	Description string `json:"description"`
+}
+
+type endpoint struct {
+	ID        string `json:"id"`
+	URL       string `json:"url"`
+	Region    string `json:"region"`
+	RegionID  string `json:"region_id"`
+	Enable    bool   `json:"enabled"`
+	Interface string `json:"interface"`
+	ServiceID string `json:"service_id"`
+
+	// ServiceName and ServiceType the service it belongs to
+	ServiceName string `json:"-"`
+	ServiceType string `json:"-"`
+}
+
+type link struct {
+	Href string `json:"href"`
+	Rel  string `json:"rel"`
+}
+
+type version struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Links  []link `json:"links"`
+	// MinVersion and MaxVersion the microversions range, empty if
+	// the version has no microversions
+	MinVersion string `json:"min_version"`
+	MaxVersion string `json:"version"`
+}
+
+// URL the self link of the version, or the first one
+func (v version) URL() string {
+	for _, l := range v.Links {
+		if l.Rel == "self" {
+			return l.Href
+		}
+	}
+	if len(v.Links) != 0 {
+		return v.Links[0].Href
+	}
+	return ""
+}
+
+// DocumentError a discovery document can not be decoded
+type DocumentError struct {
+	// Document the document, eg: services, endpoints or versions
+	Document string
+	// Field the json path of the broken field, if known
+	Field string
+	Err   error
+}
+
+func (e *DocumentError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("invalid %s document, field %s: %s", e.Document, e.Field, e.Err)
+	}
+	return fmt.Sprintf("invalid %s document: %s", e.Document, e.Err)
+}
+
+// decodeDocument decode the document into v, the unknown fields are ignored
+func decodeDocument(document string, body []byte, v interface{}) error {
+	err := json.Unmarshal(body, v)
+	if err == nil {
+		return nil
+	}
+
+	de := &DocumentError{Document: document, Err: err}
+	if te, ok := err.(*json.UnmarshalTypeError); ok {
+		de.Field = te.Field
+		de.Err = fmt.Errorf("want %s, got %s", te.Type, te.Value)
+	}
+	return de
+}
+
+func decodeServices(body []byte) ([]service, error) {
+	doc := struct {
+		Services []service `json:"services"`
+	}{}
+	if err := decodeDocument("services", body, &doc); err != nil {
+		return nil, err
+	}
+	return doc.Services, nil
+}
+
+func decodeEndpoints(body []byte) ([]endpoint, error) {
+	doc := struct {
+		Endpoints []endpoint `json:"endpoints"`
+	}{}
+	if err := decodeDocument("endpoints", body, &doc); err != nil {
+		return nil, err
+	}
+
+	for i := range doc.Endpoints {
+		if doc.Endpoints[i].Region == "" {
+			doc.Endpoints[i].Region = doc.Endpoints[i].RegionID
+		}
+	}
+	return doc.Endpoints, nil
+}
+
+// decodeVersions decode a versions document, the versions are either
+// a list or, keystone style, under "values"
+func decodeVersions(body []byte) ([]version, error) {
+	doc := struct {
+		Versions json.RawMessage `json:"versions"`
+		Version  *version        `json:"version"`
+	}{}
+	if err := decodeDocument("versions", body, &doc); err != nil {
+		return nil, err
+	}
+
+	if doc.Version != nil {
+		return []version{*doc.Version}, nil
+	}
+
+	var versions []version
+	raw := strings.TrimSpace(string(doc.Versions))
+	switch {
+	case raw == "" || raw == "null":
+		return nil, &DocumentError{Document: "versions", Field: "versions", Err: fmt.Errorf("missing")}
+	case strings.HasPrefix(raw, "["):
+		if err := decodeDocument("versions", doc.Versions, &versions); err != nil {
+			return nil, prefixField(err, "versions")
+		}
+	default:
+		values := struct {
+			Values []version `json:"values"`
+		}{}
+		if err := decodeDocument("versions", doc.Versions, &values); err != nil {
+			return nil, prefixField(err, "versions")
+		}
+		versions = values.Values
+	}
+
+	return versions, nil
+}
+
+// prefixField add the parent field to the path of a nested document error
+func prefixField(err error, parent string) error {
+	if de, ok := err.(*DocumentError); ok && de.Field != "" {
+		de.Field = parent + "." + de.Field
+	}
+	return err
+}
@@ -0,0 +1,146 @@
+package clouds
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Cloud a named cloud profile in clouds.yaml
+type Cloud struct {
+	Auth               AuthInfo `yaml:"auth"`
+	AuthType           string   `yaml:"auth_type"`
+	RegionName         string   `yaml:"region_name"`
+	Interface          string   `yaml:"interface"`
+	IdentityAPIVersion string   `yaml:"identity_api_version"`
+}
+
+// AuthInfo the auth section of a cloud profile
+type AuthInfo struct {
+	AuthURL           string `yaml:"auth_url"`
+	Username          string `yaml:"username"`
+	Password          string `yaml:"password"`
+	ProjectName       string `yaml:"project_name"`
+	UserDomainName    string `yaml:"user_domain_name"`
+	ProjectDomainName string `yaml:"project_domain_name"`
+	UserID            string `yaml:"user_id"`
+	UserDomainID      string `yaml:"user_domain_id"`
+	ProjectID         string `yaml:"project_id"`
+	ProjectDomainID   string `yaml:"project_domain_id"`
+	DomainName        string `yaml:"domain_name"`
+	DomainID          string `yaml:"domain_id"`
+
+	ApplicationCredentialID     string `yaml:"application_credential_id"`
+	ApplicationCredentialName   string `yaml:"application_credential_name"`
+	ApplicationCredentialSecret string `yaml:"application_credential_secret"`
+	Token                       string `yaml:"token"`
+}
+
+type cloudsFile struct {
+	Clouds map[string]interface{} `yaml:"clouds"`
+}
+
+// SearchPath the dirs clouds.yaml and secure.yaml are looked up in, by order
+func SearchPath() []string {
+	dirs := []string{"."}
+
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		dirs = append(dirs, filepath.Join(xdg, "openstack"))
+	} else if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".config", "openstack"))
+	}
+
+	return append(dirs, "/etc/openstack")
+}
+
+// findFile return the first existing file, env is the var overriding the search
+func findFile(env, name string) string {
+	if p := os.Getenv(env); p != "" {
+		return p
+	}
+
+	for _, dir := range SearchPath() {
+		p := filepath.Join(dir, name)
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+
+	return ""
+}
+
+// Load read the named cloud from clouds.yaml, the values in secure.yaml
+// take precedence over it
+func Load(name string) (*Cloud, error) {
+	cloudsPath := findFile("OS_CLIENT_CONFIG_FILE", "clouds.yaml")
+	if cloudsPath == "" {
+		return nil, fmt.Errorf("cloud %s: no clouds.yaml found in %v", name, SearchPath())
+	}
+
+	profile, err := readCloud(cloudsPath, name)
+	if err != nil {
+		return nil, err
+	}
+	if profile == nil {
+		return nil, fmt.Errorf("cloud %s not found in %s", name, cloudsPath)
+	}
+
+	if securePath := findFile("OS_CLIENT_SECURE_FILE", "secure.yaml"); securePath != "" {
+		secure, err := readCloud(securePath, name)
+		if err != nil {
+			return nil, err
+		}
+		if secure != nil {
+			profile = merge(profile, secure)
+		}
+	}
+
+	// decode the merged profile into the typed struct
+	data, err := yaml.Marshal(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	cloud := &Cloud{}
+	if err := yaml.Unmarshal(data, cloud); err != nil {
+		return nil, fmt.Errorf("cloud %s: %s", name, err)
+	}
+
+	return cloud, nil
+}
+
+func readCloud(path, name string) (interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := cloudsFile{}
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", path, err)
+	}
+
+	return f.Clouds[name], nil
+}
+
+// merge the values of src into dst, nested maps are merged recursively
+func merge(dst, src interface{}) interface{} {
+	dm, ok1 := dst.(map[interface{}]interface{})
+	sm, ok2 := src.(map[interface{}]interface{})
+	if !ok1 || !ok2 {
+		return src
+	}
+
+	for k, v := range sm {
+		if old, ok := dm[k]; ok {
+			dm[k] = merge(old, v)
+		} else {
+			dm[k] = v
+		}
+	}
+
+	return dm
+}
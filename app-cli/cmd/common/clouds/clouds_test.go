@@ -0,0 +1,119 @@
+package clouds
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	p := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(p, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func cloudsYAML(region string) string {
+	return "clouds:\n  test:\n    region_name: " + region + "\n    auth:\n      username: alice\n"
+}
+
+// the current dir, then $XDG_CONFIG_HOME/openstack, OS_CLIENT_CONFIG_FILE overrides both
+func TestLoadSearchPath(t *testing.T) {
+	cwd, xdg, other := t.TempDir(), t.TempDir(), t.TempDir()
+	t.Chdir(cwd)
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	t.Setenv("OS_CLIENT_CONFIG_FILE", "")
+	t.Setenv("OS_CLIENT_SECURE_FILE", "")
+	if err := os.Mkdir(filepath.Join(xdg, "openstack"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	local := writeFile(t, cwd, "clouds.yaml", cloudsYAML("local"))
+	writeFile(t, filepath.Join(xdg, "openstack"), "clouds.yaml", cloudsYAML("xdg"))
+	override := writeFile(t, other, "mine.yaml", cloudsYAML("override"))
+
+	load := func() string {
+		cloud, err := Load("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cloud.RegionName
+	}
+
+	if got := load(); got != "local" {
+		t.Errorf("want the clouds.yaml of the current dir first, got %s", got)
+	}
+	t.Setenv("OS_CLIENT_CONFIG_FILE", override)
+	if got := load(); got != "override" {
+		t.Errorf("want OS_CLIENT_CONFIG_FILE first, got %s", got)
+	}
+	t.Setenv("OS_CLIENT_CONFIG_FILE", "")
+	os.Remove(local)
+	if got := load(); got != "xdg" {
+		t.Errorf("want the clouds.yaml of XDG_CONFIG_HOME then, got %s", got)
+	}
+
+	if _, err := Load("missing"); err == nil || !strings.Contains(err.Error(), "cloud missing not found") {
+		t.Errorf("want a missing cloud to fail, got %v", err)
+	}
+}
+
+// secure.yaml is looked up on its own and its values win, nested ones too
+func TestLoadSecure(t *testing.T) {
+	cwd, xdg := t.TempDir(), t.TempDir()
+	t.Chdir(cwd)
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	t.Setenv("OS_CLIENT_CONFIG_FILE", "")
+	t.Setenv("OS_CLIENT_SECURE_FILE", "")
+	if err := os.Mkdir(filepath.Join(xdg, "openstack"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, filepath.Join(xdg, "openstack"), "clouds.yaml", `clouds:
+  test:
+    region_name: RegionOne
+    auth:
+      auth_url: http://keystone/v3
+      username: alice
+      password: from-clouds
+  other:
+    auth:
+      username: bob
+`)
+	writeFile(t, cwd, "secure.yaml", `clouds:
+  test:
+    auth:
+      password: from-secure
+      application_credential_secret: s3cret
+`)
+
+	cloud, err := Load("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := AuthInfo{
+		AuthURL: "http://keystone/v3", Username: "alice", Password: "from-secure",
+		ApplicationCredentialSecret: "s3cret",
+	}
+	if cloud.Auth != want || cloud.RegionName != "RegionOne" {
+		t.Errorf("want clouds.yaml merged with secure.yaml, got %+v", cloud)
+	}
+
+	// a cloud secure.yaml has nothing for is loaded as it is
+	if cloud, err = Load("other"); err != nil || cloud.Auth.Username != "bob" || cloud.Auth.Password != "" {
+		t.Errorf("want the other cloud as it is, got %+v, %v", cloud, err)
+	}
+
+	t.Setenv("OS_CLIENT_SECURE_FILE", writeFile(t, xdg, "mine.yaml", "clouds:\n  test:\n    auth:\n      password: from-env\n"))
+	if cloud, err = Load("test"); err != nil || cloud.Auth.Password != "from-env" {
+		t.Errorf("want the secure file of OS_CLIENT_SECURE_FILE, got %+v, %v", cloud, err)
+	}
+
+	writeFile(t, cwd, "clouds.yaml", "clouds: [")
+	if _, err := Load("test"); err == nil || !strings.Contains(err.Error(), "invalid") {
+		t.Errorf("want an invalid clouds.yaml to fail, got %v", err)
+	}
+}
@@ -1,10 +1,15 @@
 package common
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"sync"
 
-	"github.com/json-iterator/go"
+	"golang/app-cli/cmd/common/keystone"
+	"golang/app-cli/cmd/common/printer"
 )
 
 // GlobalFlag use to contain the all context
@@ -12,244 +17,522 @@ var GlobalFlag *globalFlag
 
 type globalFlag struct {
 	sdaServiceName string
+	sdaServiceType string
 	keystoneURL    string
 	sdaEndPoint    string
-	token          string
+	// authMu guard the token, the catalog and the issued token, a
+	// re-authentication may replace them while the bulk operations run
+	authMu        sync.Mutex
+	token         string
+	catalog       keystone.Catalog
+	issued        *keystone.Token
+	endpointIface string
+	regionName    string
+	apiVersion    string
+	output        string
+	columns       []string
+	out           io.Writer
+
+	ctx     context.Context
+	reAuth  func() (*keystone.Token, error)
+	retries int
+
+	// authenticate run once, the first time a client is asked for
+	authenticate func() error
+	authOnce     sync.Once
+	authErr      error
+
+	// the service url and microversion, resolved once per command and
+	// shared by the clients of the bulk operations and the polling
+	resolveOnce  sync.Once
+	endpoint     string
+	microversion string
+	resolveErr   error
 }
 
-type service struct {
-	Enabled bool
-	ID      string
-	Name    string
-	Type    string
+// getServiceEndPoint choose the endpoint by the interface and region,
+// and return the url of the api version negotiated with --os-api-version,
+// and the microversion to request, if any
+func (g *globalFlag) getServiceEndPoint(serviceName string) (string, string, error) {
+	_, u, microversion, err := g.resolveEndpoint(serviceName, func(string, ...interface{}) {})
+	return u, microversion, err
 }
 
-type endpoint struct {
-	URL       string
-	Region    string
-	Enable    bool
-	Interface string
-	ServiceID string
-	ID        string
-}
+// resolveEndpoint resolve the endpoint and the url of the service, with
+// the microversion, each step is told to explain
+func (g *globalFlag) resolveEndpoint(serviceName string, explain func(format string, a ...interface{})) (endpoint, string, string, error) {
+	explain("1. find the endpoints of the service %s", serviceName)
+	endpoints, ok := g.catalogEndpoints(serviceName)
+	if ok {
+		explain("   the token catalog has %d", len(endpoints))
+	} else {
+		// the token carries no catalog for it, fallback to the list api
+		explain("   the token catalog has none, list them by %s/services and /endpoints", g.keystoneURL)
+		var err error
+		endpoints, err = g.listEndpoints(serviceName)
+		if err != nil {
+			return endpoint{}, "", "", err
+		}
+		explain("   the identity api has %d enabled", len(endpoints))
+	}
+	for _, ep := range endpoints {
+		explain("     %s %s %s %s", ep.ID, ep.Interface, ep.Region, ep.URL)
+	}
+
+	iface, _ := NormalizeInterface(g.endpointIface)
+	if g.regionName != "" {
+		explain("2. choose the %s endpoint in the region %s, by --os-interface and --os-region-name", iface, g.regionName)
+	} else {
+		explain("2. choose the %s endpoint of any region, by --os-interface and --os-region-name", iface)
+	}
+	ep, err := selectEndpoint(serviceName, endpoints, g.endpointIface, g.regionName)
+	if err != nil {
+		return endpoint{}, "", "", err
+	}
+	explain("   %s %s", ep.ID, ep.URL)
 
-type version struct {
-	Status string
-	ID     string
-	URL    []string
+	explain("3. read the versions document %s/versions", ep.URL)
+	v, microversion, err := g.negotiateVersion(serviceName, ep.URL, explain)
+	if err != nil {
+		return endpoint{}, "", "", err
+	}
+	if microversion != "" {
+		microversion = ep.ServiceType + " " + microversion
+	}
+
+	explain("4. the service url is %s", v.URL())
+	if microversion != "" {
+		explain("   sent with %s: %s", APIVersionHeader, microversion)
+	}
+	return ep, v.URL(), microversion, nil
 }
 
-// getServiceEndPoint if one services have many endpoint, return the first one
-func (g *globalFlag) getServiceEndPoint(serviceName string) (string, error) {
+// catalogEndpoints find the service's endpoints in the token catalog,
+// all the services' if the name is empty
+func (g *globalFlag) catalogEndpoints(serviceName string) ([]endpoint, bool) {
+	var endpoints []endpoint
+	for _, s := range g.getCatalog() {
+		if serviceName != "" && s.Name != serviceName {
+			continue
+		}
+		for _, ep := range s.Endpoints {
+			region := ep.Region
+			if region == "" {
+				region = ep.RegionID
+			}
+			endpoints = append(endpoints, endpoint{
+				URL:         ep.URL,
+				Region:      region,
+				RegionID:    ep.RegionID,
+				Enable:      true,
+				Interface:   ep.Interface,
+				ServiceID:   s.ID,
+				ServiceName: s.Name,
+				ServiceType: s.Type,
+				ID:          ep.ID,
+			})
+		}
+	}
 
-	var (
-		serviceOBJ     service
-		endpoints      []endpoint
-		currentVersion version
-	)
+	return endpoints, len(endpoints) != 0
+}
 
+// listEndpoints find the service's endpoints by the /services and /endpoints api,
+// which need the list rights in keystone, all the services' if the name is empty
+func (g *globalFlag) listEndpoints(serviceName string) ([]endpoint, error) {
 	c := g.getKeystoneClient()
 
 	// get the service_id by service name
-	request := Request{
-		URL:          fmt.Sprintf("%s/services", c.URL),
-		Method:       http.MethodGet,
-		OkStatusCode: http.StatusOK,
-	}
-
-	resp, err := c.DoRequest(request)
+	var services []service
+	pager := &Pager{Client: c, URL: fmt.Sprintf("%s/services", c.URL), Key: "services", All: true}
+	err := pager.EachPage(g.Context(), func(page *Page) error {
+		s, err := decodeServices(page.Body)
+		services = append(services, s...)
+		return err
+	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	iter := jsoniter.ParseBytes(resp.Body)
-	for l1Field := iter.ReadObject(); l1Field != ""; l1Field = iter.ReadObject() {
-		switch l1Field {
-		case "services":
-			for iter.ReadArray() {
-				s := service{}
-				for l2Field := iter.ReadObject(); l2Field != ""; l2Field = iter.ReadObject() {
-					switch l2Field {
-					case "description":
-						iter.Skip()
-					case "links":
-						iter.Skip()
-					case "enabled":
-						s.Enabled = iter.ReadBool()
-					case "type":
-						s.Type = iter.ReadString()
-					case "id":
-						s.ID = iter.ReadString()
-					case "name":
-						s.Name = iter.ReadString()
-					default:
-						return "", fmt.Errorf("Get Keystone service error, Unkwon field: %s", l2Field)
-
-					}
-				}
-				if s.Enabled && s.Name == serviceName {
-					serviceOBJ = s
-				}
-			}
-		case "links":
-			iter.Skip()
+	enabled := map[string]service{}
+	var serviceOBJ service
+	for _, s := range services {
+		if s.Enabled && (serviceName == "" || s.Name == serviceName) {
+			enabled[s.ID] = s
+			serviceOBJ = s
 		}
 	}
-
-	// get this service's all endpoints
-	if serviceOBJ.ID != "" {
-		request := Request{
-			URL:          fmt.Sprintf("%s/endpoints?service_id=%s", c.URL, serviceOBJ.ID),
-			Method:       http.MethodGet,
-			OkStatusCode: http.StatusOK,
+	if len(enabled) == 0 {
+		if serviceName == "" {
+			return nil, nil
 		}
+		return nil, fmt.Errorf("service %s not found or not enabled", serviceName)
+	}
 
-		respEP, err := c.DoRequest(request)
-		if err != nil {
-			return "", err
-		}
+	// get this service's all endpoints
+	u := fmt.Sprintf("%s/endpoints", c.URL)
+	if serviceName != "" {
+		u += "?service_id=" + serviceOBJ.ID
+	}
+	var all []endpoint
+	pager = &Pager{Client: c, URL: u, Key: "endpoints", All: true}
+	err = pager.EachPage(g.Context(), func(page *Page) error {
+		eps, err := decodeEndpoints(page.Body)
+		all = append(all, eps...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		iter := jsoniter.ParseBytes(respEP.Body)
-		for l1Field := iter.ReadObject(); l1Field != ""; l1Field = iter.ReadObject() {
-			switch l1Field {
-			case "endpoints":
-				for iter.ReadArray() {
-					ep := endpoint{}
-					for l2Field := iter.ReadObject(); l2Field != ""; l2Field = iter.ReadObject() {
-						switch l2Field {
-						case "region_id":
-							iter.Skip()
-						case "links":
-							iter.Skip()
-						case "url":
-							ep.URL = iter.ReadString()
-						case "region":
-							ep.Region = iter.ReadString()
-						case "enabled":
-							ep.Enable = iter.ReadBool()
-						case "interface":
-							ep.Interface = iter.ReadString()
-						case "service_id":
-							ep.ServiceID = iter.ReadString()
-						case "id":
-							ep.ID = iter.ReadString()
-						default:
-							return "", fmt.Errorf("Get Keystone endpoint error, Unkwon field: %s", l2Field)
-						}
-					}
-					if ep.Enable {
-						endpoints = append(endpoints, ep)
-					}
-				}
-			case "links":
-				iter.Skip()
-			}
+	var endpoints []endpoint
+	for _, ep := range all {
+		s, ok := enabled[ep.ServiceID]
+		if ep.Enable && ok {
+			ep.ServiceName = s.Name
+			ep.ServiceType = s.Type
+			endpoints = append(endpoints, ep)
 		}
 	}
 
-	// if have many versin choice the current one
-	requestROOT := Request{
-		URL:          fmt.Sprintf("%s/versions", endpoints[0].URL),
+	return endpoints, nil
+}
+
+// negotiateVersion read the versions document of the endpoint, and choose
+// the version matching --os-api-version, the current one if it's not set
+func (g *globalFlag) negotiateVersion(serviceName, endpointURL string, explain func(string, ...interface{})) (version, string, error) {
+	c := g.getKeystoneClient()
+
+	resp, err := c.DoRequest(g.Context(), Request{
+		URL:          fmt.Sprintf("%s/versions", endpointURL),
 		Method:       http.MethodGet,
 		OkStatusCode: http.StatusOK,
+	})
+	if err != nil {
+		return version{}, "", err
 	}
 
-	respROOT, err := c.DoRequest(requestROOT)
+	versions, err := decodeVersions(resp.Body)
 	if err != nil {
-		return "", err
+		return version{}, "", err
 	}
 
-	iter = jsoniter.ParseBytes(respROOT.Body)
-	for l1Field := iter.ReadObject(); l1Field != ""; l1Field = iter.ReadObject() {
-		switch l1Field {
-		case "versions":
-			for iter.ReadArray() {
-				v := version{}
-				for l2Field := iter.ReadObject(); l2Field != ""; l2Field = iter.ReadObject() {
-					switch l2Field {
-					case "status":
-						v.Status = iter.ReadString()
-					case "id":
-						v.ID = iter.ReadString()
-					case "links":
-						for iter.ReadArray() {
-							for l3Field := iter.ReadObject(); l3Field != ""; l3Field = iter.ReadObject() {
-								switch l3Field {
-								case "href":
-									v.URL = append(v.URL, iter.ReadString())
-								case "rel":
-									iter.Skip()
-								}
-							}
-						}
-					default:
-						return "", fmt.Errorf("Get service current version error, Unkwon field: %s", l2Field)
-
-					}
-				}
-				if v.Status == "CURRENT" {
-					currentVersion = v
-				}
-			}
+	for _, v := range versions {
+		if v.MaxVersion != "" {
+			explain("     %s %s, microversions %s to %s", v.ID, v.Status, v.MinVersion, v.MaxVersion)
+		} else {
+			explain("     %s %s", v.ID, v.Status)
 		}
 	}
 
-	if len(currentVersion.URL) != 0 {
-		return currentVersion.URL[0], nil
+	v, microversion, err := negotiateVersion(serviceName, versions, g.apiVersion)
+	if err != nil {
+		return version{}, "", err
+	}
+	if g.apiVersion == "" {
+		explain("   choose the current version %s, --os-api-version is not set", v.ID)
+	} else {
+		explain("   choose %s for --os-api-version %s", v.ID, g.apiVersion)
+	}
+	if v.URL() == "" {
+		return version{}, "", fmt.Errorf("not endpoint find for %s", serviceName)
 	}
 
-	return "", fmt.Errorf("not endpoint find for %s", serviceName)
+	return v, microversion, nil
+}
+
+// SetAuthenticator set the func fetching the token and catalog, it's
+// deferred until a command really asks for a client, so the commands
+// never talking to the apis need no credentials
+func (g *globalFlag) SetAuthenticator(fn func() error) {
+	g.authenticate = fn
+	g.authOnce = sync.Once{}
+	g.authErr = nil
+	g.resolveOnce = sync.Once{}
+}
+
+// Authenticate run the authenticator if not yet, the token set directly
+// by SetToken is used as is when there is none
+func (g *globalFlag) Authenticate() error {
+	if g.authenticate == nil {
+		return nil
+	}
+	g.authOnce.Do(func() {
+		g.authErr = g.authenticate()
+	})
+	return g.authErr
 }
 
 func (g *globalFlag) SetToken(token string) {
+	g.authMu.Lock()
+	defer g.authMu.Unlock()
 	g.token = token
 }
 
+// SetIssued set the token issued by the authentication, and its catalog
+func (g *globalFlag) SetIssued(token *keystone.Token) {
+	g.authMu.Lock()
+	defer g.authMu.Unlock()
+	g.issued, g.token, g.catalog = token, token.ID, token.Catalog
+}
+
+// Issued the token issued by the authentication, the latest one if it
+// was re-authenticated
+func (g *globalFlag) Issued() *keystone.Token {
+	g.authMu.Lock()
+	defer g.authMu.Unlock()
+	return g.issued
+}
+
+// SetContext set the context the requests are sent with, it's canceled
+// on interrupt or when the --timeout exceeded
+func (g *globalFlag) SetContext(ctx context.Context) {
+	g.ctx = ctx
+}
+
+// Context the context the requests are sent with
+func (g *globalFlag) Context() context.Context {
+	if g.ctx == nil {
+		return context.Background()
+	}
+	return g.ctx
+}
+
+// SetReAuth set the func issuing a new token when the current one is rejected
+func (g *globalFlag) SetReAuth(fn func() (*keystone.Token, error)) {
+	g.reAuth = fn
+}
+
+// reAuthenticate issue a new token in place of the rejected one, once
+// for all the requests rejected at the same time: the ones finding the
+// token already replaced get the new one
+func (g *globalFlag) reAuthenticate(rejected string) (string, error) {
+	g.authMu.Lock()
+	defer g.authMu.Unlock()
+
+	if g.token != rejected {
+		return g.token, nil
+	}
+	token, err := g.reAuth()
+	if err != nil {
+		return "", err
+	}
+	g.issued, g.token, g.catalog = token, token.ID, token.Catalog
+	return g.token, nil
+}
+
+// SetRetries set how many times an idempotent request is retried
+func (g *globalFlag) SetRetries(n int) {
+	g.retries = n
+}
+
+func (g *globalFlag) newClient(url string) (*Client, error) {
+	client, err := NewClient(url, g.GetToken())
+	if err != nil {
+		return nil, err
+	}
+	client.Retry.MaxRetries = g.retries
+	if g.reAuth != nil {
+		client.ReAuth = g.reAuthenticate
+	}
+	return client, nil
+}
+
 func (g *globalFlag) SetKeystoneURL(url string) {
 	g.keystoneURL = url
 }
 
+// KeystoneURL the versioned identity url, set once authenticated
+func (g *globalFlag) KeystoneURL() string {
+	return g.keystoneURL
+}
+
 func (g *globalFlag) SetSDAServiceName(name string) {
 	g.sdaServiceName = name
+	g.resolveOnce = sync.Once{}
+}
+
+// SetSDAServiceType set the service type the microversion is requested
+// for, with --api-endpoint, the catalog tells it otherwise
+func (g *globalFlag) SetSDAServiceType(serviceType string) {
+	g.sdaServiceType = serviceType
+	g.resolveOnce = sync.Once{}
+}
+
+// SetAPIVersion set the api version or microversion requested, eg: 1, 1.5 or latest
+func (g *globalFlag) SetAPIVersion(v string) {
+	g.apiVersion = v
+	g.resolveOnce = sync.Once{}
+}
+
+// SetEndpointFilter set the interface and region used to choose the endpoint
+func (g *globalFlag) SetEndpointFilter(iface, region string) {
+	g.endpointIface = iface
+	g.regionName = region
+	g.resolveOnce = sync.Once{}
+}
+
+// SetOutput set the output format and the table columns
+func (g *globalFlag) SetOutput(output string, columns []string) {
+	g.output = output
+	g.columns = columns
+}
+
+// Printer return the printer of the output format, the table prints
+// the default columns unless --columns is set
+func (g *globalFlag) Printer(defaultColumns []string) (printer.Printer, error) {
+	columns := g.columns
+	if len(columns) == 0 {
+		columns = defaultColumns
+	}
+	return printer.New(g.output, columns)
+}
+
+// PrintObj print the object by the output format
+func (g *globalFlag) PrintObj(obj interface{}, defaultColumns []string) error {
+	p, err := g.Printer(defaultColumns)
+	if err != nil {
+		return err
+	}
+	return p.PrintObj(obj, g.Out())
+}
+
+// PrintPages print the pages of the list as they come, json and yaml
+// wait for the last page as the whole list is one document
+func (g *globalFlag) PrintPages(pager *Pager, defaultColumns []string) error {
+	p, err := g.Printer(defaultColumns)
+	if err != nil {
+		return err
+	}
+
+	var stream bool
+	switch p.(type) {
+	case *printer.JSONPrinter, *printer.YAMLPrinter:
+	default:
+		stream = true
+	}
+
+	all := []interface{}{}
+	err = pager.EachPage(g.Context(), func(page *Page) error {
+		if !stream {
+			all = append(all, page.Items...)
+			return nil
+		}
+		return p.PrintObj(page.Items, g.Out())
+	})
+	if err != nil {
+		return err
+	}
+	if !stream {
+		return p.PrintObj(all, g.Out())
+	}
+	return nil
+}
+
+// SetOut set where the results are printed, stdout by default
+func (g *globalFlag) SetOut(w io.Writer) {
+	g.out = w
+}
+
+// Out where the results are printed
+func (g *globalFlag) Out() io.Writer {
+	if g.out == nil {
+		return os.Stdout
+	}
+	return g.out
+}
+
+// SetCatalog set the service catalog issued with the token
+func (g *globalFlag) SetCatalog(catalog keystone.Catalog) {
+	g.authMu.Lock()
+	defer g.authMu.Unlock()
+	g.catalog = catalog
+}
+
+func (g *globalFlag) getCatalog() keystone.Catalog {
+	g.authMu.Lock()
+	defer g.authMu.Unlock()
+	return g.catalog
 }
 
 func (g *globalFlag) GetToken() string {
+	g.authMu.Lock()
+	defer g.authMu.Unlock()
 	return g.token
 }
 
 func (g *globalFlag) SetSDAEndPoint(endpoint string) {
 	g.sdaEndPoint = endpoint
+	g.resolveOnce = sync.Once{}
 }
 
 func (g *globalFlag) getKeystoneClient() *Client {
-	client, _ := NewClient(g.keystoneURL, g.token)
+	client, _ := g.newClient(g.keystoneURL)
 	return client
 }
 
+// GetSDAClient return a client of the service, the endpoint is resolved
+// by the first call of the command
 func (g *globalFlag) GetSDAClient() (*Client, error) {
+	if err := g.Authenticate(); err != nil {
+		return nil, err
+	}
 
-	var (
-		endpoint string
-		err      error
-	)
-
-	if g.sdaEndPoint == "" {
-		endpoint, err = g.getServiceEndPoint(g.sdaServiceName)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		endpoint = g.sdaEndPoint
+	g.resolveOnce.Do(func() {
+		g.endpoint, g.microversion, g.resolveErr = g.resolveSDAEndpoint()
+	})
+	if g.resolveErr != nil {
+		return nil, g.resolveErr
 	}
 
-	client, err := NewClient(endpoint, g.token)
+	client, err := g.newClient(g.endpoint)
 	if err != nil {
 		return nil, err
 	}
+	if g.microversion != "" {
+		client.Headers = http.Header{}
+		client.Headers.Set(APIVersionHeader, g.microversion)
+	}
 
 	return client, nil
 }
 
+// resolveSDAEndpoint return the service url and the microversion to request
+func (g *globalFlag) resolveSDAEndpoint() (string, string, error) {
+	if g.sdaEndPoint == "" {
+		return g.getServiceEndPoint(g.sdaServiceName)
+	}
+
+	// no versions document to negotiate with, trust the requested one
+	requested := ""
+	if g.apiVersion == LatestAPIVersion {
+		requested = g.apiVersion
+	} else if v, err := parseAPIVersion(g.apiVersion); err == nil && v.Minor >= 0 {
+		requested = v.String()
+	}
+	if requested == "" {
+		return g.sdaEndPoint, "", nil
+	}
+
+	serviceType, err := g.serviceType()
+	if err != nil {
+		return "", "", err
+	}
+	return g.sdaEndPoint, serviceType + " " + requested, nil
+}
+
+// serviceType the type of the service of --api-endpoint, by --service-type
+// or the catalog entry of --service-name
+func (g *globalFlag) serviceType() (string, error) {
+	if g.sdaServiceType != "" {
+		return g.sdaServiceType, nil
+	}
+	if s, ok := g.getCatalog().Service(g.sdaServiceName); ok && g.sdaServiceName != "" && s.Type != "" {
+		return s.Type, nil
+	}
+	return "", fmt.Errorf("the microversion %s needs the service type of --api-endpoint, set --service-type", g.apiVersion)
+}
+
 func init() {
 	if GlobalFlag == nil {
 		GlobalFlag = &globalFlag{}
@@ -0,0 +1,170 @@
+package common
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"golang/app-cli/cmd/common/keystone"
+	"golang/app-cli/cmd/common/keystone/keystonetest"
+)
+
+// newGlobalFlag authenticate against the fake keystone as alice
+func newGlobalFlag(t *testing.T, srv *keystonetest.Server) *globalFlag {
+	client, err := keystone.NewIdentity(context.Background(), srv.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scope, _ := keystone.NewScope(keystone.NewProject("", keystonetest.DefaultProject,
+		keystone.NewDomain("", keystonetest.DefaultDomain)), nil)
+	token, err := client.GetToken(context.Background(), keystone.NewAuth(keystone.User{
+		Name:     keystonetest.DefaultUser,
+		Password: keystonetest.DefaultPassword,
+		Domain:   keystone.NewDomain("", keystonetest.DefaultDomain),
+	}, scope))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := &globalFlag{}
+	g.SetToken(token.ID)
+	g.SetCatalog(token.Catalog)
+	g.SetKeystoneURL(client.BaseURL())
+	return g
+}
+
+func TestGetServiceEndPoint(t *testing.T) {
+	srv := keystonetest.NewServer()
+	defer srv.Close()
+	srv.Services[0].Endpoints = append(srv.Services[0].Endpoints,
+		keystonetest.Endpoint{ID: "e-internal", Interface: "internal", Region: "RegionOne", URL: "/internal", Enabled: true},
+		keystonetest.Endpoint{ID: "e-public-2", Interface: "public", Region: "RegionTwo", URL: "/sda", Enabled: true},
+	)
+
+	for _, noCatalog := range []bool{false, true} {
+		srv.NoCatalog = noCatalog
+		g := newGlobalFlag(t, srv)
+
+		got, _, err := g.getServiceEndPoint(keystonetest.DefaultService)
+		if err != nil {
+			t.Fatalf("nocatalog=%v: %s", noCatalog, err)
+		}
+		if want := srv.URL + "/sda/v1"; got != want {
+			t.Errorf("nocatalog=%v: want %s, got %s", noCatalog, want, got)
+		}
+	}
+
+	// the catalog spares the /services and /endpoints calls
+	if n := srv.Count("GET /v3/services"); n != 1 {
+		t.Errorf("want the list api called only without catalog, got %d calls", n)
+	}
+}
+
+func TestGetServiceEndPointNoMatch(t *testing.T) {
+	srv := keystonetest.NewServer()
+	defer srv.Close()
+
+	g := newGlobalFlag(t, srv)
+	g.SetEndpointFilter("admin", "RegionOne")
+
+	_, _, err := g.getServiceEndPoint(keystonetest.DefaultService)
+	if err == nil {
+		t.Fatal("want an error for no admin endpoint")
+	}
+	if !strings.Contains(err.Error(), "public RegionOne") {
+		t.Errorf("want the candidates listed, got %s", err)
+	}
+}
+
+func TestDecodeDocuments(t *testing.T) {
+	// the fields keystone may add later must not break the discovery
+	endpoints, err := decodeEndpoints([]byte(`{"endpoints": [{"id": "e1", "url": "http://sda",
+		"interface": "public", "region_id": "RegionOne", "enabled": true,
+		"description": "new field", "links": {"self": "x"}}], "links": {}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 1 || endpoints[0].Region != "RegionOne" {
+		t.Errorf("want the region taken from region_id, got %+v", endpoints)
+	}
+
+	versions, err := decodeVersions([]byte(`{"versions": {"values": [{"id": "v1.0",
+		"status": "CURRENT", "media-types": [{"base": "application/json"}],
+		"links": [{"href": "http://sda/v1", "rel": "self"}]}]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions[0].URL() != "http://sda/v1" {
+		t.Errorf("want the keystone style versions decoded, got %+v", versions)
+	}
+
+	_, err = decodeServices([]byte(`{"services": [{"id": "s1", "enabled": "yes"}]}`))
+	de, ok := err.(*DocumentError)
+	if !ok || de.Document != "services" || !strings.Contains(de.Field, "enabled") {
+		t.Errorf("want a services document error on the enabled field, got %v", err)
+	}
+}
+
+func TestNegotiateVersion(t *testing.T) {
+	versions := []version{
+		{ID: "v1.0", Status: "SUPPORTED"},
+		{ID: "v2.0", Status: "CURRENT", MinVersion: "2.1", MaxVersion: "2.20"},
+	}
+
+	for _, c := range []struct {
+		requested, id, microversion string
+	}{
+		{"", "v2.0", ""},
+		{"latest", "v2.0", "2.20"},
+		{"1", "v1.0", ""},
+		{"1.0", "v1.0", ""},
+		{"2.5", "v2.0", "2.5"},
+		{"v2.20", "v2.0", "2.20"},
+	} {
+		v, microversion, err := negotiateVersion("sda", versions, c.requested)
+		if err != nil {
+			t.Errorf("%q: %s", c.requested, err)
+			continue
+		}
+		if v.ID != c.id || microversion != c.microversion {
+			t.Errorf("%q: want %s %q, got %s %q", c.requested, c.id, c.microversion, v.ID, microversion)
+		}
+	}
+
+	for _, requested := range []string{"2.21", "2.0", "3", "1.1", "x"} {
+		if _, _, err := negotiateVersion("sda", versions, requested); err == nil {
+			t.Errorf("%q: want unsupported", requested)
+		}
+	}
+}
+
+func TestAPIEndpointMicroversion(t *testing.T) {
+	g := &globalFlag{}
+	g.SetSDAEndPoint("http://sda.example/v1")
+	g.SetAPIVersion("1.5")
+
+	if _, err := g.GetSDAClient(); err == nil || !strings.Contains(err.Error(), "--service-type") {
+		t.Errorf("want the service type asked for, got %v", err)
+	}
+
+	g.SetSDAServiceName("sda")
+	g.SetCatalog(keystone.Catalog{{Name: "sda", Type: "shared-file-system"}})
+	client, err := g.GetSDAClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := client.Headers.Get(APIVersionHeader); got != "shared-file-system 1.5" {
+		t.Errorf("want the catalog service type, got %q", got)
+	}
+
+	g.SetSDAServiceType("sda-type")
+	if client, err = g.GetSDAClient(); err != nil || client.Headers.Get(APIVersionHeader) != "sda-type 1.5" {
+		t.Errorf("want --service-type used, got %v %v", err, client)
+	}
+
+	g.SetAPIVersion("1")
+	if client, err = g.GetSDAClient(); err != nil || client.Headers.Get(APIVersionHeader) != "" {
+		t.Errorf("want no microversion for a major version, got %v %v", err, client)
+	}
+}
@@ -0,0 +1,222 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DefaultInterface the endpoint interface used when none is set
+const DefaultInterface = "public"
+
+// NormalizeInterface accept both "public" and the v2 style "publicURL"
+func NormalizeInterface(iface string) (string, error) {
+	if iface == "" {
+		return DefaultInterface, nil
+	}
+
+	iface = strings.TrimSuffix(strings.ToLower(iface), "url")
+	switch iface {
+	case "public", "internal", "admin":
+		return iface, nil
+	}
+
+	return "", fmt.Errorf("invalid endpoint interface %q, must be one of public, internal, admin", iface)
+}
+
+// selectEndpoint choose the enabled endpoint matching the interface and region,
+// if more than one matched, the one with the smallest region and id wins
+func selectEndpoint(serviceName string, endpoints []endpoint, iface, region string) (endpoint, error) {
+	iface, err := NormalizeInterface(iface)
+	if err != nil {
+		return endpoint{}, err
+	}
+
+	if len(endpoints) == 0 {
+		return endpoint{}, fmt.Errorf("no endpoint found for service %s", serviceName)
+	}
+
+	var matched []endpoint
+	for _, ep := range endpoints {
+		if !ep.Enable || ep.Interface != iface {
+			continue
+		}
+		if region != "" && ep.Region != region {
+			continue
+		}
+		matched = append(matched, ep)
+	}
+
+	if len(matched) == 0 {
+		candidates := make([]string, 0, len(endpoints))
+		for _, ep := range endpoints {
+			candidates = append(candidates, fmt.Sprintf("  %s %s %s", ep.Interface, ep.Region, ep.URL))
+		}
+		sort.Strings(candidates)
+
+		want := iface
+		if region != "" {
+			want = fmt.Sprintf("%s in region %s", iface, region)
+		}
+		return endpoint{}, fmt.Errorf("no %s endpoint found for service %s, candidates:\n%s",
+			want, serviceName, strings.Join(candidates, "\n"))
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].Region != matched[j].Region {
+			return matched[i].Region < matched[j].Region
+		}
+		return matched[i].ID < matched[j].ID
+	})
+
+	return matched[0], nil
+}
+
+// serviceEndpoints the service's endpoints, all the services' if the name
+// is empty, from the token catalog or else the identity api
+func (g *globalFlag) serviceEndpoints(serviceName string) ([]endpoint, error) {
+	if err := g.Authenticate(); err != nil {
+		return nil, err
+	}
+	if endpoints, ok := g.catalogEndpoints(serviceName); ok {
+		return endpoints, nil
+	}
+	return g.listEndpoints(serviceName)
+}
+
+// filterEndpoints keep the endpoints of the interface and region, any if empty
+func filterEndpoints(endpoints []endpoint, iface, region string) ([]endpoint, error) {
+	if iface != "" {
+		var err error
+		if iface, err = NormalizeInterface(iface); err != nil {
+			return nil, err
+		}
+	}
+
+	var matched []endpoint
+	for _, ep := range endpoints {
+		if (iface == "" || ep.Interface == iface) && (region == "" || ep.Region == region) {
+			matched = append(matched, ep)
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		a, b := matched[i], matched[j]
+		if a.ServiceName != b.ServiceName {
+			return a.ServiceName < b.ServiceName
+		}
+		if a.Interface != b.Interface {
+			return a.Interface < b.Interface
+		}
+		return a.Region < b.Region
+	})
+	return matched, nil
+}
+
+// Endpoints the endpoints of the service, of all if the name is empty,
+// filtered by the interface and region, as objects to print
+func (g *globalFlag) Endpoints(serviceName, iface, region string) ([]interface{}, error) {
+	endpoints, err := g.serviceEndpoints(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	if endpoints, err = filterEndpoints(endpoints, iface, region); err != nil {
+		return nil, err
+	}
+
+	rows := []interface{}{}
+	for _, ep := range endpoints {
+		rows = append(rows, map[string]interface{}{
+			"id":           ep.ID,
+			"service_name": ep.ServiceName,
+			"service_type": ep.ServiceType,
+			"interface":    ep.Interface,
+			"region":       ep.Region,
+			"url":          ep.URL,
+		})
+	}
+	return rows, nil
+}
+
+// Catalog the services and their endpoints, filtered by the interface
+// and region, as objects to print
+func (g *globalFlag) Catalog(iface, region string) ([]interface{}, error) {
+	endpoints, err := g.serviceEndpoints("")
+	if err != nil {
+		return nil, err
+	}
+	if endpoints, err = filterEndpoints(endpoints, iface, region); err != nil {
+		return nil, err
+	}
+
+	rows := []interface{}{}
+	byName := map[string]map[string]interface{}{}
+	for _, ep := range endpoints {
+		row, ok := byName[ep.ServiceName]
+		if !ok {
+			row = map[string]interface{}{
+				"name":      ep.ServiceName,
+				"type":      ep.ServiceType,
+				"endpoints": []interface{}{},
+			}
+			byName[ep.ServiceName] = row
+			rows = append(rows, row)
+		}
+		row["endpoints"] = append(row["endpoints"].([]interface{}),
+			fmt.Sprintf("%s %s %s", ep.Interface, ep.Region, ep.URL))
+	}
+	return rows, nil
+}
+
+// ShowEndpoint the endpoint of the service chosen by the interface and
+// region, with the url of the negotiated version, as an object to print.
+// The name defaults to the service of --service-name
+func (g *globalFlag) ShowEndpoint(serviceName string) (interface{}, error) {
+	if err := g.Authenticate(); err != nil {
+		return nil, err
+	}
+	if serviceName == "" {
+		serviceName = g.sdaServiceName
+	}
+
+	ep, u, microversion, err := g.resolveEndpoint(serviceName, func(string, ...interface{}) {})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"id":           ep.ID,
+		"service_name": serviceName,
+		"service_type": ep.ServiceType,
+		"interface":    ep.Interface,
+		"region":       ep.Region,
+		"url":          ep.URL,
+		"version_url":  u,
+		"microversion": microversion,
+	}, nil
+}
+
+// ExplainEndpoint tell how the url of the service is resolved, step by
+// step. The name defaults to the service of --service-name
+func (g *globalFlag) ExplainEndpoint(serviceName string, w io.Writer) error {
+	explain := func(format string, a ...interface{}) {
+		fmt.Fprintf(w, format+"\n", a...)
+	}
+
+	if err := g.Authenticate(); err != nil {
+		return err
+	}
+	if serviceName == "" {
+		serviceName = g.sdaServiceName
+		if g.sdaEndPoint != "" {
+			explain("--api-endpoint is set, %s is used as is, without the catalog nor the versions document", g.sdaEndPoint)
+			return nil
+		}
+	}
+
+	_, _, _, err := g.resolveEndpoint(serviceName, explain)
+	if err != nil {
+		explain("failed: %s", err)
+	}
+	return err
+}
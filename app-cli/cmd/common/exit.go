@@ -0,0 +1,108 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"golang/app-cli/cmd/common/apierror"
+)
+
+// the exit codes of the commands, scripts may branch on them, the
+// root help lists them too:
+//
+//	0   ok
+//	1   ExitError          any other error, eg: invalid flags
+//	2   ExitAuth           the credentials are missing or rejected, 401 and 403,
+//	                       or the authentication failed otherwise, eg: a wrong --auth-url
+//	3   ExitNotFound       404
+//	4   ExitConflict       409 and 412
+//	5   ExitValidation     the request is invalid, 400, 413 and 422
+//	6   ExitTimeout        --timeout or --wait-timeout expired, 408
+//	7   ExitServer         5xx and 429
+//	8   ExitResourceFailed the resource went into a failure status
+//	130 the command was interrupted
+const (
+	ExitError          = 1
+	ExitAuth           = 2
+	ExitNotFound       = 3
+	ExitConflict       = 4
+	ExitValidation     = 5
+	ExitTimeout        = 6
+	ExitServer         = 7
+	ExitResourceFailed = 8
+)
+
+// ExitCoder an error choosing the exit code of the command
+type ExitCoder interface {
+	error
+	ExitCode() int
+}
+
+type exitError struct {
+	error
+	code int
+}
+
+func (e *exitError) ExitCode() int {
+	return e.code
+}
+
+func (e *exitError) Unwrap() error {
+	return e.error
+}
+
+// WithExitCode use to make the command exit with code when err is returned
+func WithExitCode(err error, code int) error {
+	return &exitError{error: err, code: code}
+}
+
+// ExitCode the exit code of the error, see the table above
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var ec ExitCoder
+	if errors.As(err, &ec) {
+		return ec.ExitCode()
+	}
+
+	var apiErr *apierror.APIError
+	if errors.As(err, &apiErr) {
+		return StatusExitCode(apiErr.StatusCode)
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ExitTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ExitTimeout
+	}
+
+	return ExitError
+}
+
+// StatusExitCode the exit code of an api error status
+func StatusExitCode(statusCode int) int {
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ExitAuth
+	case http.StatusNotFound:
+		return ExitNotFound
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return ExitConflict
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return ExitValidation
+	case http.StatusRequestTimeout:
+		return ExitTimeout
+	case http.StatusTooManyRequests:
+		return ExitServer
+	}
+	if statusCode >= 500 {
+		return ExitServer
+	}
+	return ExitError
+}
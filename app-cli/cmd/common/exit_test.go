@@ -0,0 +1,69 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"golang/app-cli/cmd/common/apierror"
+)
+
+func TestParseMessage(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"error": {"code": 401, "title": "Unauthorized", "message": "The request you have made requires authentication."}}`,
+			"The request you have made requires authentication."},
+		{`{"itemNotFound": {"code": 404, "message": "Instance 1f2e could not be found."}}`, "Instance 1f2e could not be found."},
+		{`{"NeutronError": {"type": "NetworkNotFound", "message": "Network 1f2e could not be found.", "detail": ""}}`,
+			"Network 1f2e could not be found."},
+		{`{"errors": [{"status": 409, "title": "Conflict", "detail": "name is taken"}]}`, "Conflict: name is taken"},
+		{`{"error_message": "{\"faultstring\": \"Node 1f2e is locked\", \"debuginfo\": null}"}`, "Node 1f2e is locked"},
+		{`{"message": "Quota exceeded"}`, "Quota exceeded"},
+		{`{"error": "invalid_request"}`, "invalid_request"},
+		{"<html>Bad Gateway</html>\n", "<html>Bad Gateway</html>"},
+	}
+	for _, tt := range tests {
+		if got := apierror.ParseMessage([]byte(tt.body)); got != tt.want {
+			t.Errorf("ParseMessage(%s) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	headers := http.Header{}
+	headers.Set(apierror.RequestIDHeader, "req-1f2e")
+	notFound := apierror.New(http.MethodGet, "http://sda/v1/a/1", http.StatusNotFound, headers,
+		[]byte(`{"error": {"message": "a 1 could not be found."}}`))
+	if want := "404 Not Found: a 1 could not be found. (request id req-1f2e)"; notFound.Error() != want {
+		t.Errorf("got %q, want %q", notFound.Error(), want)
+	}
+
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, 0},
+		{errors.New("invalid flag"), ExitError},
+		{notFound, ExitNotFound},
+		{fmt.Errorf("token rejected, re-authenticate failed: %w",
+			apierror.New(http.MethodPost, "", http.StatusUnauthorized, nil, nil)), ExitAuth},
+		{apierror.New(http.MethodPut, "", http.StatusConflict, nil, nil), ExitConflict},
+		{apierror.New(http.MethodPost, "", http.StatusBadRequest, nil, nil), ExitValidation},
+		{apierror.New(http.MethodGet, "", http.StatusServiceUnavailable, nil, nil), ExitServer},
+		{fmt.Errorf("list: %w", context.DeadlineExceeded), ExitTimeout},
+		{WithExitCode(errors.New("missing auth"), ExitAuth), ExitAuth},
+	}
+	for _, tt := range tests {
+		if got := ExitCode(tt.err); got != tt.want {
+			t.Errorf("ExitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+
+	if !apierror.New(http.MethodGet, "", http.StatusServiceUnavailable, nil, nil).Retryable || notFound.Retryable {
+		t.Errorf("want only 503 retryable")
+	}
+}
@@ -1,8 +1,29 @@
 package keystone
 
+import "fmt"
+
+// the keystone v3 identity methods
+const (
+	MethodPassword              = "password"
+	MethodApplicationCredential = "application_credential"
+	MethodToken                 = "token"
+)
+
 // Domain keystone Domain
 type Domain struct {
-	Name string `json:"name"`
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// NewDomain use to new a domain by id or name, nil if both are empty
+func NewDomain(id, name string) *Domain {
+	if id == "" && name == "" {
+		return nil
+	}
+	if id != "" {
+		return &Domain{ID: id}
+	}
+	return &Domain{Name: name}
 }
 
 // IdentifyUser keystone user
@@ -12,28 +33,78 @@ type IdentifyUser struct {
 
 // User keystone user
 type User struct {
-	Name     string `json:"name"`
-	Password string `json:"password"`
-	Domain   Domain `json:"domain"`
+	ID       string  `json:"id,omitempty"`
+	Name     string  `json:"name,omitempty"`
+	Password string  `json:"password,omitempty"`
+	Domain   *Domain `json:"domain,omitempty"`
+}
+
+// ApplicationCredential keystone application credential, identified by
+// id, or by name and the user owning it
+type ApplicationCredential struct {
+	ID     string `json:"id,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Secret string `json:"secret"`
+	User   *User  `json:"user,omitempty"`
+}
+
+// TokenID an existing token used to issue a new one
+type TokenID struct {
+	ID string `json:"id"`
 }
 
 // Identity keystone ID
 type Identity struct {
-	Methods  []string     `json:"methods"`
-	Password IdentifyUser `json:"password"`
+	Methods               []string               `json:"methods"`
+	Password              *IdentifyUser          `json:"password,omitempty"`
+	ApplicationCredential *ApplicationCredential `json:"application_credential,omitempty"`
+	Token                 *TokenID               `json:"token,omitempty"`
 }
+
+// Scope the project or the domain a token is scoped to
 type Scope struct {
-	Project Project `json:"project"`
+	Project *Project `json:"project,omitempty"`
+	Domain  *Domain  `json:"domain,omitempty"`
 }
+
+// Project keystone project, a project name is only unique in its domain
 type Project struct {
-	Name   string `json:"name"`
-	Domain Domain `json:"domain"`
+	ID     string  `json:"id,omitempty"`
+	Name   string  `json:"name,omitempty"`
+	Domain *Domain `json:"domain,omitempty"`
+}
+
+// NewProject use to new a project by id, or by name in the domain,
+// nil if both id and name are empty
+func NewProject(id, name string, domain *Domain) *Project {
+	if id == "" && name == "" {
+		return nil
+	}
+	if id != "" {
+		return &Project{ID: id}
+	}
+	return &Project{Name: name, Domain: domain}
+}
+
+// NewScope use to new a project scope or a domain scope,
+// nil means an unscoped token
+func NewScope(project *Project, domain *Domain) (*Scope, error) {
+	if project != nil && domain != nil {
+		return nil, fmt.Errorf("a token can not be scoped to both a project and a domain")
+	}
+	if project != nil && project.ID == "" && project.Domain == nil {
+		return nil, fmt.Errorf("project %s needs a project domain name or id", project.Name)
+	}
+	if project == nil && domain == nil {
+		return nil, nil
+	}
+	return &Scope{Project: project, Domain: domain}, nil
 }
 
 // Auth with ID
 type Auth struct {
 	Identity Identity `json:"identity"`
-	Scope    Scope    `json:"scope"`
+	Scope    *Scope   `json:"scope,omitempty"`
 }
 
 // SingleAuth for password
@@ -41,24 +112,67 @@ type SingleAuth struct {
 	Auth Auth `json:"auth"`
 }
 
-// NewAuth use to new auth
-func NewAuth(username, password, domainName, projectName string) Auth {
+// NewAuth use to new a password auth, user is identified by id, or by
+// name in its domain. A nil scope issue an unscoped token
+func NewAuth(user User, scope *Scope) Auth {
+	return Auth{
+		Identity: Identity{
+			Methods:  []string{MethodPassword},
+			Password: &IdentifyUser{User: user},
+		},
+		Scope: scope,
+	}
+}
+
+// NewApplicationCredentialAuth use to new auth by an application credential,
+// user is only needed when the credential is identified by name.
+// The credential is bound to its project, so no scope is set
+func NewApplicationCredentialAuth(id, name, secret string, user *User) (Auth, error) {
+	if secret == "" {
+		return Auth{}, fmt.Errorf("application credential secret must not be empty")
+	}
+	if id == "" && (name == "" || user == nil) {
+		return Auth{}, fmt.Errorf("application credential needs an id, or a name and its user")
+	}
+
+	cred := &ApplicationCredential{ID: id, Secret: secret}
+	if id == "" {
+		cred.Name = name
+		cred.User = user
+	}
+
 	return Auth{
 		Identity: Identity{
-			Methods: []string{"password"},
-			Password: IdentifyUser{
-				User: User{
-					Name:     username,
-					Password: password,
-					Domain:   Domain{Name: domainName},
-				},
-			},
+			Methods:               []string{MethodApplicationCredential},
+			ApplicationCredential: cred,
 		},
-		Scope: Scope{
-			Project: Project{
-				Name:   projectName,
-				Domain: Domain{Name: domainName},
-			},
+	}, nil
+}
+
+// NewTokenAuth use to new auth by an existing token, eg: to re-scope it
+// to another project or domain
+func NewTokenAuth(token string, scope *Scope) Auth {
+	return Auth{
+		Identity: Identity{
+			Methods: []string{MethodToken},
+			Token:   &TokenID{ID: token},
 		},
+		Scope: scope,
+	}
+}
+
+// withoutSecrets return a copy of auth with the password and secret removed,
+// the token is kept since it identifies whom the new token is issued for
+func (a Auth) withoutSecrets() Auth {
+	if a.Identity.Password != nil {
+		p := *a.Identity.Password
+		p.User.Password = ""
+		a.Identity.Password = &p
+	}
+	if a.Identity.ApplicationCredential != nil {
+		c := *a.Identity.ApplicationCredential
+		c.Secret = ""
+		a.Identity.ApplicationCredential = &c
 	}
+	return a
 }
@@ -0,0 +1,152 @@
+package keystone
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ExpiryWindow a cached token expiring sooner than this is not reused
+const ExpiryWindow = 5 * time.Minute
+
+// TokenCache keep issued tokens on disk, so that every cli invocation
+// does not need to authenticate against keystone again
+type TokenCache struct {
+	Dir string
+}
+
+// NewTokenCache use to new a token cache store in dir
+func NewTokenCache(dir string) *TokenCache {
+	return &TokenCache{Dir: dir}
+}
+
+// DefaultTokenCacheDir the per user cache dir, eg: ~/.cache/app-cli/tokens
+func DefaultTokenCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "app-cli", "tokens")
+}
+
+// CacheKey identify the user, scope, auth url and identity api version
+// a token belongs to, the password and secret in auth are not part of the key
+func CacheKey(authURL, version string, auth Auth) string {
+	data, _ := json.Marshal(auth.withoutSecrets())
+	sum := sha256.Sum256(append([]byte(authURL+"\n"+version+"\n"), data...))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *TokenCache) path(key string) string {
+	return filepath.Join(c.Dir, key+".json")
+}
+
+// Get return the cached token, if it's not close to expiring
+func (c *TokenCache) Get(key string) (*Token, bool) {
+	t := &Token{}
+	if !c.read(key, t) || !t.ValidFor(ExpiryWindow) {
+		return nil, false
+	}
+	return t, true
+}
+
+// Put save the token, only the current user can read it
+func (c *TokenCache) Put(key string, t *Token) error {
+	return c.write(key, t)
+}
+
+// CachedIdentity the identity api version discovered at an auth url, and
+// the versioned url of it
+type CachedIdentity struct {
+	Version string `json:"version"`
+	URL     string `json:"url"`
+}
+
+// identityKey the key of the identity discovered at the auth url
+func identityKey(authURL string) string {
+	sum := sha256.Sum256([]byte("identity\n" + authURL))
+	return "identity-" + hex.EncodeToString(sum[:])
+}
+
+// GetIdentity return the identity api discovered at the auth url, so a
+// cached token is reused without asking keystone again
+func (c *TokenCache) GetIdentity(authURL string) (*CachedIdentity, bool) {
+	id := &CachedIdentity{}
+	if !c.read(identityKey(authURL), id) || id.Version == "" || id.URL == "" {
+		return nil, false
+	}
+	return id, true
+}
+
+// PutIdentity save the identity api discovered at the auth url
+func (c *TokenCache) PutIdentity(authURL string, id CachedIdentity) error {
+	return c.write(identityKey(authURL), id)
+}
+
+// DeleteIdentity drop the identity api of the auth url, eg: it's stale
+func (c *TokenCache) DeleteIdentity(authURL string) error {
+	return c.Delete(identityKey(authURL))
+}
+
+// read decode the cache file of the key into v
+func (c *TokenCache) read(key string, v interface{}) bool {
+	fi, err := os.Stat(c.path(key))
+	if err != nil {
+		return false
+	}
+	// do not trust a file other users could have read or written
+	if fi.Mode().Perm()&0077 != 0 {
+		return false
+	}
+
+	data, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, v) == nil
+}
+
+// write save v as the cache file of the key, only the current user can read it
+func (c *TokenCache) write(key string, v interface{}) error {
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(c.Dir, key+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), c.path(key))
+}
+
+// Delete drop the cached token, eg: when keystone rejected it
+func (c *TokenCache) Delete(key string) error {
+	err := os.Remove(c.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
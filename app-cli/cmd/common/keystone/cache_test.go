@@ -0,0 +1,118 @@
+package keystone
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenCache(t *testing.T) {
+	c := NewTokenCache(filepath.Join(t.TempDir(), "tokens"))
+	token := &Token{ID: "t1", ExpiresAt: time.Now().Add(time.Hour)}
+
+	if _, ok := c.Get("k"); ok {
+		t.Fatal("want a miss on an empty cache")
+	}
+	if err := c.Put("k", token); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(c.path("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Errorf("want the token file 0600, got %o", perm)
+	}
+	if got, ok := c.Get("k"); !ok || got.ID != "t1" {
+		t.Errorf("want the cached token, got %v, %v", got, ok)
+	}
+
+	// a file others can read or write is not trusted
+	for _, perm := range []os.FileMode{0640, 0604, 0620, 0602} {
+		if err := os.Chmod(c.path("k"), perm); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := c.Get("k"); ok {
+			t.Errorf("want the token of a %o file ignored", perm)
+		}
+	}
+
+	for _, expires := range []time.Duration{-time.Minute, ExpiryWindow - time.Minute} {
+		if err := c.Put("k", &Token{ID: "t2", ExpiresAt: time.Now().Add(expires)}); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := c.Get("k"); ok {
+			t.Errorf("want a token expiring in %s ignored", expires)
+		}
+	}
+
+	if err := c.Delete("k"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete("k"); err != nil {
+		t.Errorf("want deleting a missing token ok, got %s", err)
+	}
+}
+
+func TestCachedIdentity(t *testing.T) {
+	c := NewTokenCache(filepath.Join(t.TempDir(), "tokens"))
+	if _, ok := c.GetIdentity("http://keystone"); ok {
+		t.Fatal("want a miss on an empty cache")
+	}
+
+	want := CachedIdentity{Version: "3", URL: "http://keystone/identity/v3"}
+	if err := c.PutIdentity("http://keystone", want); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := c.GetIdentity("http://keystone"); !ok || *got != want {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+	if _, ok := c.GetIdentity("http://other"); ok {
+		t.Error("want the identity of another auth url missed")
+	}
+
+	if err := c.DeleteIdentity("http://keystone"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.GetIdentity("http://keystone"); ok {
+		t.Error("want the deleted identity missed")
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	domain := NewDomain("", "Default")
+	scope := func(project string) *Scope {
+		s, _ := NewScope(NewProject("", project, domain), nil)
+		return s
+	}
+	auth := func(user, password, project string) Auth {
+		return NewAuth(User{Name: user, Password: password, Domain: domain}, scope(project))
+	}
+	key := CacheKey("http://keystone/v3", "3", auth("alice", "s3cret", "demo"))
+
+	if other := CacheKey("http://keystone/v3", "3", auth("alice", "changed", "demo")); other != key {
+		t.Error("want the same key whatever the password")
+	}
+	for name, other := range map[string]string{
+		"user":     CacheKey("http://keystone/v3", "3", auth("bob", "s3cret", "demo")),
+		"project":  CacheKey("http://keystone/v3", "3", auth("alice", "s3cret", "other")),
+		"auth url": CacheKey("http://other/v3", "3", auth("alice", "s3cret", "demo")),
+		"version":  CacheKey("http://keystone/v3", "2.0", auth("alice", "s3cret", "demo")),
+	} {
+		if other == key {
+			t.Errorf("want another key for another %s", name)
+		}
+	}
+
+	cred, err := NewApplicationCredentialAuth("a1", "", "s3cret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{key, CacheKey("http://keystone/v3", "3", cred)} {
+		if strings.Contains(k, "s3cret") || strings.Contains(k, "alice") || len(k) != 64 {
+			t.Errorf("want the key a sha256 hex digest, got %s", k)
+		}
+	}
+}
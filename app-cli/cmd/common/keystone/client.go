@@ -2,21 +2,43 @@ package keystone
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"time"
+
+	"golang/app-cli/cmd/common/apierror"
 )
 
 // TOKEN_HEADER use to save keystone token
 const TOKEN_HEADER = "X-Subject-Token"
 
+// HTTPClient is used by all the keystone requests
+var HTTPClient = &http.Client{Timeout: 60 * time.Second}
+
 type request struct {
 	URL          string
 	Method       string
 	Body         []byte
 	OkStatusCode int
+	// OkStatusCodes the other status codes also accepted
+	OkStatusCodes []int
+	Headers       http.Header
+}
+
+func (r request) isOk(code int) bool {
+	if code == r.OkStatusCode {
+		return true
+	}
+	for _, c := range r.OkStatusCodes {
+		if code == c {
+			return true
+		}
+	}
+	return false
 }
 
 type response struct {
@@ -25,6 +47,7 @@ type response struct {
 	Headers    http.Header
 }
 
+// Client the keystone v3 identity api client
 type Client struct {
 	URL string
 }
@@ -36,16 +59,28 @@ func NewClient(url string) (*Client, error) {
 	return &Client{URL: url}, nil
 }
 
-func (c *Client) doRequest(r request) (response, error) {
-	client := &http.Client{}
+// Version the identity api version
+func (c *Client) Version() string {
+	return "3"
+}
+
+// BaseURL the versioned identity api url
+func (c *Client) BaseURL() string {
+	return c.URL
+}
 
+func (c *Client) doRequest(ctx context.Context, r request) (response, error) {
 	req, err := http.NewRequest(r.Method, r.URL, bytes.NewBuffer(r.Body))
 	if err != nil {
 		return response{}, err
 	}
+	req = req.WithContext(ctx)
 	req.Header.Set("Content-Type", "application/json")
+	for k, v := range r.Headers {
+		req.Header[k] = v
+	}
 
-	resp, err := client.Do(req)
+	resp, err := HTTPClient.Do(req)
 	if err != nil {
 		return response{}, err
 	}
@@ -56,8 +91,8 @@ func (c *Client) doRequest(r request) (response, error) {
 		return response{}, err
 	}
 
-	if resp.StatusCode != r.OkStatusCode {
-		return response{}, fmt.Errorf("Error: %s details: %s\n", resp.Status, body)
+	if !r.isOk(resp.StatusCode) {
+		return response{}, apierror.New(r.Method, r.URL, resp.StatusCode, resp.Header, body)
 	}
 
 	return response{
@@ -66,13 +101,14 @@ func (c *Client) doRequest(r request) (response, error) {
 		Headers:    resp.Header}, nil
 }
 
-func (c *Client) GetToken(auth Auth) (string, error) {
+// GetToken issue a token, the expiry is parsed from the token body
+func (c *Client) GetToken(ctx context.Context, auth Auth) (*Token, error) {
 	jsonStr, err := json.Marshal(SingleAuth{Auth: auth})
 	if err != nil {
-		return "", fmt.Errorf("invalid auth request: ", err)
+		return nil, fmt.Errorf("invalid auth request: %s", err)
 	}
 
-	resp, err := c.doRequest(request{
+	resp, err := c.doRequest(ctx, request{
 		URL:          fmt.Sprintf("%s/auth/tokens", c.URL),
 		Method:       http.MethodPost,
 		Body:         jsonStr,
@@ -80,15 +116,47 @@ func (c *Client) GetToken(auth Auth) (string, error) {
 	})
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	// note: not unmarshalling response body right now
-	// since dont need anything from it yet
-	token := resp.Headers.Get(TOKEN_HEADER)
-	if token == "" {
-		return "", errors.New("No token found in response")
+	id := resp.Headers.Get(TOKEN_HEADER)
+	if id == "" {
+		return nil, errors.New("No token found in response")
 	}
 
-	return token, nil
+	return parseToken(id, resp.Body)
+}
+
+// ValidateToken check the subject token with the auth token, and return
+// it with its scope, roles and catalog
+func (c *Client) ValidateToken(ctx context.Context, authToken, subjectToken string) (*Token, error) {
+	resp, err := c.doRequest(ctx, request{
+		URL:          fmt.Sprintf("%s/auth/tokens", c.URL),
+		Method:       http.MethodGet,
+		OkStatusCode: http.StatusOK,
+		Headers:      tokenHeaders(authToken, subjectToken),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return parseToken(subjectToken, resp.Body)
+}
+
+// RevokeToken revoke the subject token with the auth token
+func (c *Client) RevokeToken(ctx context.Context, authToken, subjectToken string) error {
+	_, err := c.doRequest(ctx, request{
+		URL:          fmt.Sprintf("%s/auth/tokens", c.URL),
+		Method:       http.MethodDelete,
+		OkStatusCode: http.StatusNoContent,
+		Headers:      tokenHeaders(authToken, subjectToken),
+	})
+	return err
+}
+
+func tokenHeaders(authToken, subjectToken string) http.Header {
+	h := http.Header{}
+	h.Set("X-Auth-Token", authToken)
+	h.Set(TOKEN_HEADER, subjectToken)
+	return h
 }
@@ -0,0 +1,146 @@
+package keystone
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// IdentityAPI issue tokens from keystone, whatever identity api version it speaks
+type IdentityAPI interface {
+	Version() string
+	BaseURL() string
+	GetToken(ctx context.Context, auth Auth) (*Token, error)
+}
+
+// NewIdentity use to new the identity api client of the version, eg: 3 or 2.0.
+// An empty or "auto" version is discovered from the auth url
+func NewIdentity(ctx context.Context, authURL, version string) (IdentityAPI, error) {
+	if authURL == "" {
+		return nil, fmt.Errorf("missing URL")
+	}
+	authURL = strings.TrimSuffix(authURL, "/")
+
+	var err error
+	switch normalizeVersion(version) {
+	case "3":
+		return NewClient(versionedURL(authURL, "v3"))
+	case "2.0":
+		return NewClientV2(versionedURL(authURL, "v2.0"))
+	case "":
+		if version, authURL, err = discover(ctx, authURL); err != nil {
+			return nil, err
+		}
+		return NewVersionedIdentity(authURL, version)
+	}
+
+	return nil, fmt.Errorf("unsupported identity api version %q, must be 3 or 2.0", version)
+}
+
+// NewVersionedIdentity use to new the identity api client of the version at
+// the versioned url as it is, eg: a discovered one
+func NewVersionedIdentity(url, version string) (IdentityAPI, error) {
+	switch normalizeVersion(version) {
+	case "3":
+		return NewClient(url)
+	case "2.0":
+		return NewClientV2(url)
+	}
+	return nil, fmt.Errorf("unsupported identity api version %q, must be 3 or 2.0", version)
+}
+
+// normalizeVersion map "v3", "3.0", "v2" and the like to "3" or "2.0"
+func normalizeVersion(version string) string {
+	version = strings.TrimPrefix(strings.ToLower(version), "v")
+	switch version {
+	case "3", "3.0":
+		return "3"
+	case "2", "2.0":
+		return "2.0"
+	case "", "auto":
+		return ""
+	}
+	return version
+}
+
+// versionedURL append the version path to a root auth url
+func versionedURL(authURL, path string) string {
+	i := strings.LastIndex(authURL, "/")
+	switch authURL[i+1:] {
+	case "v3", "v2.0":
+		return authURL
+	}
+	return authURL + "/" + path
+}
+
+type versionDoc struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Links  []struct {
+		Href string `json:"href"`
+		Rel  string `json:"rel"`
+	} `json:"links"`
+}
+
+func (v versionDoc) self() string {
+	for _, l := range v.Links {
+		if l.Rel == "self" {
+			return strings.TrimSuffix(l.Href, "/")
+		}
+	}
+	return ""
+}
+
+// discover read the auth url, which is either the root document listing
+// all the versions, or the document of a single version
+func discover(ctx context.Context, authURL string) (string, string, error) {
+	c := &Client{URL: authURL}
+	resp, err := c.doRequest(ctx, request{
+		URL:           authURL,
+		Method:        http.MethodGet,
+		OkStatusCode:  http.StatusOK,
+		OkStatusCodes: []int{http.StatusMultipleChoices},
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("discover identity api version: %w", err)
+	}
+
+	doc := struct {
+		Version  *versionDoc `json:"version"`
+		Versions struct {
+			Values []versionDoc `json:"values"`
+		} `json:"versions"`
+	}{}
+	if err := json.Unmarshal(resp.Body, &doc); err != nil {
+		return "", "", fmt.Errorf("discover identity api version: %w", err)
+	}
+
+	if doc.Version != nil {
+		return normalizeVersion(strings.SplitN(doc.Version.ID, ".", 2)[0]), authURL, nil
+	}
+
+	// prefer v3 to v2.0
+	var v2 *versionDoc
+	for i, v := range doc.Versions.Values {
+		switch {
+		case strings.HasPrefix(v.ID, "v3"):
+			return "3", selfOr(v, authURL+"/v3"), nil
+		case strings.HasPrefix(v.ID, "v2"):
+			v2 = &doc.Versions.Values[i]
+		}
+	}
+	if v2 != nil {
+		return "2.0", selfOr(*v2, authURL+"/v2.0"), nil
+	}
+
+	return "", "", fmt.Errorf("no supported identity api version found at %s", authURL)
+}
+
+func selfOr(v versionDoc, def string) string {
+	if href := v.self(); href != "" {
+		return href
+	}
+	return def
+}
@@ -0,0 +1,41 @@
+package keystone
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewIdentityDiscover(t *testing.T) {
+	var doc string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Replace(doc, "URL", "http://"+r.Host, -1)))
+	}))
+	defer srv.Close()
+
+	for _, c := range []struct {
+		doc, version, url, err string
+	}{
+		{`{"version":{"id":"v3.14","links":[{"rel":"self","href":"URL/v3/"}]}}`, "3", srv.URL, ""},
+		{`{"version":{"id":"v2.0"}}`, "2.0", srv.URL, ""},
+		{`{"versions":{"values":[{"id":"v2.0"},{"id":"v3.10","links":[{"rel":"self","href":"URL/identity/v3/"}]}]}}`,
+			"3", srv.URL + "/identity/v3", ""},
+		{`{"version":{"id":"v4.0"}}`, "", "", `unsupported identity api version "4"`},
+		{`{"versions":{"values":[{"id":"v4.0"}]}}`, "", "", "no supported identity api version"},
+	} {
+		doc = c.doc
+		client, err := NewIdentity(context.Background(), srv.URL, "")
+		switch {
+		case c.err != "":
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: want an error with %q, got %v", c.doc, c.err, err)
+			}
+		case err != nil:
+			t.Errorf("%s: %s", c.doc, err)
+		case client.Version() != c.version || client.BaseURL() != c.url:
+			t.Errorf("%s: want v%s at %s, got v%s at %s", c.doc, c.version, c.url, client.Version(), client.BaseURL())
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package keystonetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang/app-cli/cmd/common/keystone"
+)
+
+// authTokens issue a token by the password, application_credential
+// or token method of a POST /v3/auth/tokens request
+func (s *Server) authTokens(w http.ResponseWriter, r *http.Request) {
+	req := keystone.SingleAuth{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid auth request: "+err.Error())
+		return
+	}
+	auth := req.Auth
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		user      *User
+		projectID string
+	)
+
+	id := auth.Identity
+	switch {
+	case id.Password != nil:
+		user = s.findUser(id.Password.User)
+		if user == nil || user.Password != id.Password.User.Password {
+			writeError(w, http.StatusUnauthorized, "The request you have made requires authentication.")
+			return
+		}
+
+	case id.ApplicationCredential != nil:
+		cred := s.findAppCred(id.ApplicationCredential)
+		if cred == nil || cred.Secret != id.ApplicationCredential.Secret {
+			writeError(w, http.StatusUnauthorized, "Invalid application credential.")
+			return
+		}
+		user = s.userByID(cred.UserID)
+		projectID = cred.Project
+
+	case id.Token != nil:
+		t, ok := s.Tokens[id.Token.ID]
+		if !ok || t.Revoked || time.Now().After(t.ExpiresAt) {
+			writeError(w, http.StatusNotFound, "Could not find token.")
+			return
+		}
+		user = s.userByID(t.UserID)
+
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported auth methods")
+		return
+	}
+
+	var domainID string
+	if auth.Scope != nil {
+		switch {
+		case auth.Scope.Project != nil:
+			p := s.findProject(auth.Scope.Project)
+			if p == nil || !member(user, p.ID) {
+				writeError(w, http.StatusUnauthorized, "User has no access to project.")
+				return
+			}
+			projectID = p.ID
+		case auth.Scope.Domain != nil:
+			d := auth.Scope.Domain
+			if d.ID != user.Domain.ID && d.Name != user.Domain.Name {
+				writeError(w, http.StatusUnauthorized, "User has no access to domain.")
+				return
+			}
+			domainID = user.Domain.ID
+		}
+	}
+
+	t := s.issue(user.ID, projectID, domainID, id.Methods)
+
+	w.Header().Set(keystone.TOKEN_HEADER, t.ID)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"token": s.tokenBody(t)})
+}
+
+// subjectToken validate the X-Subject-Token by GET, revoke it by DELETE
+func (s *Server) subjectToken(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.Header.Get(keystone.TOKEN_HEADER)
+	t, ok := s.Tokens[id]
+	if !ok || t.Revoked || !time.Now().Before(t.ExpiresAt) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Could not find token: %s.", id))
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		t.Revoked = true
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set(keystone.TOKEN_HEADER, t.ID)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"token": s.tokenBody(t)})
+}
+
+// issue a token, the caller holds the lock
+func (s *Server) issue(userID, projectID, domainID string, methods []string) *Token {
+	t := &Token{
+		ID:        s.nextID("token"),
+		UserID:    userID,
+		ProjectID: projectID,
+		DomainID:  domainID,
+		Methods:   methods,
+		ExpiresAt: time.Now().Add(s.TokenTTL).UTC(),
+	}
+	s.Tokens[t.ID] = t
+	return t
+}
+
+// tokenBody the token document, the caller holds the lock
+func (s *Server) tokenBody(t *Token) map[string]interface{} {
+	u := s.userByID(t.UserID)
+
+	body := map[string]interface{}{
+		"methods":    t.Methods,
+		"expires_at": t.ExpiresAt.Format(time.RFC3339),
+		"issued_at":  t.ExpiresAt.Add(-s.TokenTTL).Format(time.RFC3339),
+		"user": map[string]interface{}{
+			"id":     u.ID,
+			"name":   u.Name,
+			"domain": u.Domain,
+		},
+		"roles": []map[string]string{{"id": "r-member", "name": "member"}},
+	}
+
+	switch {
+	case t.ProjectID != "":
+		p := s.projectByID(t.ProjectID)
+		body["project"] = map[string]interface{}{
+			"id":     p.ID,
+			"name":   p.Name,
+			"domain": p.Domain,
+		}
+	case t.DomainID != "":
+		body["domain"] = u.Domain
+	default:
+		// an unscoped token has no roles nor catalog
+		delete(body, "roles")
+		return body
+	}
+
+	if !s.NoCatalog {
+		body["catalog"] = s.catalog()
+	}
+	return body
+}
+
+func (s *Server) catalog() []interface{} {
+	catalog := []interface{}{}
+	for _, svc := range s.Services {
+		if !svc.Enabled {
+			continue
+		}
+		endpoints := []interface{}{}
+		for _, ep := range svc.Endpoints {
+			if !ep.Enabled {
+				continue
+			}
+			endpoints = append(endpoints, map[string]interface{}{
+				"id":        ep.ID,
+				"interface": ep.Interface,
+				"region":    ep.Region,
+				"region_id": ep.Region,
+				"url":       s.absURL(ep.URL),
+			})
+		}
+		catalog = append(catalog, map[string]interface{}{
+			"id":        svc.ID,
+			"name":      svc.Name,
+			"type":      svc.Type,
+			"endpoints": endpoints,
+		})
+	}
+	return catalog
+}
+
+func matchDomain(d Domain, want *keystone.Domain) bool {
+	if want == nil {
+		return false
+	}
+	return (want.ID != "" && want.ID == d.ID) || (want.Name != "" && want.Name == d.Name)
+}
+
+func (s *Server) findUser(u keystone.User) *User {
+	for i := range s.Users {
+		user := &s.Users[i]
+		if u.ID != "" && u.ID == user.ID {
+			return user
+		}
+		if u.Name == user.Name && matchDomain(user.Domain, u.Domain) {
+			return user
+		}
+	}
+	return nil
+}
+
+func (s *Server) userByID(id string) *User {
+	return s.findUser(keystone.User{ID: id})
+}
+
+func (s *Server) findProject(p *keystone.Project) *Project {
+	for i := range s.Projects {
+		project := &s.Projects[i]
+		if p.ID != "" && p.ID == project.ID {
+			return project
+		}
+		if p.Name == project.Name && matchDomain(project.Domain, p.Domain) {
+			return project
+		}
+	}
+	return nil
+}
+
+func (s *Server) projectByID(id string) *Project {
+	return s.findProject(&keystone.Project{ID: id})
+}
+
+func (s *Server) findAppCred(c *keystone.ApplicationCredential) *ApplicationCredential {
+	for i := range s.ApplicationCredentials {
+		cred := &s.ApplicationCredentials[i]
+		if c.ID != "" && c.ID == cred.ID {
+			return cred
+		}
+		if c.Name != "" && c.Name == cred.Name && c.User != nil {
+			if u := s.findUser(*c.User); u != nil && u.ID == cred.UserID {
+				return cred
+			}
+		}
+	}
+	return nil
+}
+
+func member(u *User, projectID string) bool {
+	for _, p := range u.Projects {
+		if p == projectID {
+			return true
+		}
+	}
+	return false
+}
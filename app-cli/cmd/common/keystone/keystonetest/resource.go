@@ -0,0 +1,287 @@
+package keystonetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ResourceAPI an in-memory CRUD api of a resource collection in the
+// openstack style, a list is {"<plural>": [...]} and a resource is
+// {"<singular>": {...}}. Serve it by Server.Handle(api.Path, api)
+type ResourceAPI struct {
+	Path     string
+	Singular string
+	Plural   string
+	// MaxPageSize cap the list pages like the real apis, 0 means no cap.
+	// A capped page links the next one by "<plural>_links"
+	MaxPageSize int
+	// Async the statuses a created or updated resource moves through, one
+	// step per GET, eg: BUILD, ACTIVE. When set the operations answer 202
+	// and a deleted resource is DELETING for one GET before it's gone
+	Async []string
+	// FailWith the status the requests of a method are answered with,
+	// eg: {"PUT": 409}
+	FailWith map[string]int
+
+	mu      sync.Mutex
+	items   map[string]map[string]interface{}
+	order   []string
+	seq     int
+	pending map[string][]string
+}
+
+// NewResourceAPI use to new an empty resource api
+func NewResourceAPI(path, singular, plural string) *ResourceAPI {
+	return &ResourceAPI{
+		Path:     strings.Trim(path, "/"),
+		Singular: singular,
+		Plural:   plural,
+		items:    map[string]map[string]interface{}{},
+		pending:  map[string][]string{},
+	}
+}
+
+// Add store the resource, an id and the ACTIVE status are set if missing
+func (a *ResourceAPI) Add(obj map[string]interface{}) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.add(obj)
+}
+
+func (a *ResourceAPI) add(obj map[string]interface{}) string {
+	id, _ := obj["id"].(string)
+	if id == "" {
+		a.seq++
+		id = fmt.Sprintf("%s-%d", a.Singular, a.seq)
+		obj["id"] = id
+	}
+	if _, ok := obj["status"]; !ok {
+		obj["status"] = "ACTIVE"
+	}
+
+	if _, ok := a.items[id]; !ok {
+		a.order = append(a.order, id)
+	}
+	a.items[id] = obj
+	return id
+}
+
+// Get return a copy of the stored resource
+func (a *ResourceAPI) Get(id string) (map[string]interface{}, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	obj, ok := a.items[id]
+	if !ok {
+		return nil, false
+	}
+	return copyObj(obj), true
+}
+
+// Len how many resources are stored
+func (a *ResourceAPI) Len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.items)
+}
+
+// ServeHTTP serve GET/POST on the collection and GET/PUT/DELETE on a resource
+func (a *ResourceAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(strings.Trim(r.URL.Path, "/"), a.Path), "/")
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if code := a.FailWith[r.Method]; code != 0 {
+		writeError(w, code, fmt.Sprintf("%s %s failed", r.Method, r.URL.Path))
+		return
+	}
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		a.list(w, r)
+	case id == "" && r.Method == http.MethodPost:
+		obj, ok := a.decode(w, r)
+		if !ok {
+			return
+		}
+		delete(obj, "id")
+		id := a.add(obj)
+		writeJSON(w, a.start(id, http.StatusCreated), map[string]interface{}{a.Singular: obj})
+	case id != "" && r.Method == http.MethodGet:
+		obj, ok := a.items[id]
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("%s %s could not be found.", a.Singular, id))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{a.Singular: obj})
+		a.step(id)
+	case id != "" && r.Method == http.MethodPut:
+		old, ok := a.items[id]
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("%s %s could not be found.", a.Singular, id))
+			return
+		}
+		obj, ok := a.decode(w, r)
+		if !ok {
+			return
+		}
+		for k, v := range obj {
+			if k != "id" {
+				old[k] = v
+			}
+		}
+		writeJSON(w, a.start(id, http.StatusOK), map[string]interface{}{a.Singular: old})
+	case id != "" && r.Method == http.MethodDelete:
+		obj, ok := a.items[id]
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("%s %s could not be found.", a.Singular, id))
+			return
+		}
+		if len(a.Async) != 0 {
+			obj["status"] = "DELETING"
+			a.pending[id] = []string{""}
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		a.remove(id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, r.Method+" is not allowed")
+	}
+}
+
+// start the async statuses of the resource, return the status code
+// of the operation
+func (a *ResourceAPI) start(id string, code int) int {
+	if len(a.Async) == 0 {
+		return code
+	}
+	a.items[id]["status"] = a.Async[0]
+	a.pending[id] = append([]string{}, a.Async[1:]...)
+	return http.StatusAccepted
+}
+
+// step move the resource to its next async status after a GET, an
+// empty status means it's gone
+func (a *ResourceAPI) step(id string) {
+	next, ok := a.pending[id]
+	if !ok {
+		return
+	}
+	switch {
+	case len(next) == 0:
+		delete(a.pending, id)
+		return
+	case next[0] == "":
+		a.remove(id)
+		delete(a.pending, id)
+		return
+	}
+	a.items[id]["status"] = next[0]
+	a.pending[id] = next[1:]
+}
+
+func (a *ResourceAPI) remove(id string) {
+	delete(a.items, id)
+	for i, o := range a.order {
+		if o == id {
+			a.order = append(a.order[:i], a.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// list the resources matching all the query parameters, a page of
+// them when limit or marker is given
+func (a *ResourceAPI) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	marker := query.Get("marker")
+	limit := 0
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit "+v)
+			return
+		}
+		limit = n
+	}
+	if a.MaxPageSize > 0 && (limit == 0 || limit > a.MaxPageSize) {
+		limit = a.MaxPageSize
+	}
+	query.Del("limit")
+	query.Del("marker")
+
+	if marker != "" {
+		if _, ok := a.items[marker]; !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("marker %s could not be found.", marker))
+			return
+		}
+	}
+
+	items := []interface{}{}
+	started := marker == ""
+	more := false
+	for _, id := range a.order {
+		if !started {
+			started = id == marker
+			continue
+		}
+		obj := a.items[id]
+		if !matchQuery(obj, query) {
+			continue
+		}
+		if limit > 0 && len(items) == limit {
+			more = true
+			break
+		}
+		items = append(items, obj)
+	}
+
+	body := map[string]interface{}{a.Plural: items}
+	if more {
+		// relative to the page, the path here is stripped of the prefix
+		q := r.URL.Query()
+		q.Set("marker", items[len(items)-1].(map[string]interface{})["id"].(string))
+		q.Set("limit", strconv.Itoa(limit))
+		body[a.Plural+"_links"] = []interface{}{
+			map[string]string{"rel": "next", "href": "?" + q.Encode()},
+		}
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+func (a *ResourceAPI) decode(w http.ResponseWriter, r *http.Request) (map[string]interface{}, bool) {
+	body := map[string]map[string]interface{}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return nil, false
+	}
+	obj, ok := body[a.Singular]
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("body must be an object under %q", a.Singular))
+		return nil, false
+	}
+	return obj, true
+}
+
+func matchQuery(obj map[string]interface{}, query map[string][]string) bool {
+	for k, v := range query {
+		if fmt.Sprint(obj[k]) != v[0] {
+			return false
+		}
+	}
+	return true
+}
+
+func copyObj(obj map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(obj))
+	for k, v := range obj {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,380 @@
+// Package keystonetest run an in-process fake keystone and service api,
+// so the auth, the endpoint discovery and the resource commands can be
+// tested offline.
+package keystonetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Domain a keystone domain
+type Domain struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// User a keystone user and the projects it's a member of
+type User struct {
+	ID       string
+	Name     string
+	Domain   Domain
+	Password string
+	Projects []string
+}
+
+// Project a keystone project
+type Project struct {
+	ID     string
+	Name   string
+	Domain Domain
+}
+
+// ApplicationCredential a credential of a user bound to a project
+type ApplicationCredential struct {
+	ID      string
+	Name    string
+	Secret  string
+	UserID  string
+	Project string
+}
+
+// Endpoint a service endpoint, URL is relative to the server if it starts with "/"
+type Endpoint struct {
+	ID        string
+	Interface string
+	Region    string
+	URL       string
+	Enabled   bool
+}
+
+// Service a service in the catalog
+type Service struct {
+	ID        string
+	Name      string
+	Type      string
+	Enabled   bool
+	Endpoints []Endpoint
+}
+
+// Token an issued token
+type Token struct {
+	ID        string
+	UserID    string
+	ProjectID string
+	DomainID  string
+	Methods   []string
+	ExpiresAt time.Time
+	Revoked   bool
+}
+
+// Server a fake keystone v3 serving /v3/auth/tokens, /v3/services,
+// /v3/endpoints and the version documents, the v2.0 /v2.0/tokens, and
+// the service api under /sda
+type Server struct {
+	*httptest.Server
+
+	mu sync.Mutex
+
+	Users                  []User
+	Projects               []Project
+	ApplicationCredentials []ApplicationCredential
+	Services               []Service
+	Tokens                 map[string]*Token
+
+	// TokenTTL how long the issued tokens live
+	TokenTTL time.Duration
+	// NoCatalog issue the tokens without catalog, so the clients
+	// have to fallback to /services and /endpoints
+	NoCatalog bool
+	// ServiceVersions the versions document served at /sda/versions
+	ServiceVersions []Version
+
+	// Requests count the requests by "METHOD /path"
+	Requests map[string]int
+	// OnRequest is called before each request is served, if set
+	OnRequest func(r *http.Request)
+
+	handlers   map[string]http.Handler
+	requestSeq int
+	seq        int
+}
+
+// Version a version in a versions document, Href is relative to the server
+type Version struct {
+	ID     string
+	Status string
+	Href   string
+}
+
+// the defaults of NewServer
+const (
+	DefaultUser     = "alice"
+	DefaultPassword = "secret"
+	DefaultProject  = "demo"
+	DefaultDomain   = "Default"
+	DefaultService  = "sda"
+)
+
+// NewServer start a fake keystone with a user alice/secret, a project demo
+// in the Default domain, and a public sda service endpoint at /sda
+func NewServer() *Server {
+	domain := Domain{ID: "default", Name: DefaultDomain}
+
+	s := &Server{
+		Users: []User{{
+			ID:       "u-alice",
+			Name:     DefaultUser,
+			Domain:   domain,
+			Password: DefaultPassword,
+			Projects: []string{"p-demo"},
+		}},
+		Projects: []Project{{ID: "p-demo", Name: DefaultProject, Domain: domain}},
+		Services: []Service{{
+			ID:      "s-sda",
+			Name:    DefaultService,
+			Type:    "sda",
+			Enabled: true,
+			Endpoints: []Endpoint{
+				{ID: "e-public", Interface: "public", Region: "RegionOne", URL: "/sda", Enabled: true},
+			},
+		}},
+		ServiceVersions: []Version{{ID: "v1.0", Status: "CURRENT", Href: "/sda/v1"}},
+		Tokens:          map[string]*Token{},
+		TokenTTL:        time.Hour,
+		Requests:        map[string]int{},
+		handlers:        map[string]http.Handler{},
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// IdentityURL the v3 auth url
+func (s *Server) IdentityURL() string {
+	return s.URL + "/v3"
+}
+
+// Handle serve the service api at /sda/v1/<path>, only for valid tokens
+func (s *Server) Handle(path string, h http.Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[strings.Trim(path, "/")] = h
+}
+
+// IssueToken issue a token for the user scoped to the project directly
+func (s *Server) IssueToken(userID, projectID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.issue(userID, projectID, "", []string{"password"}).ID
+}
+
+// RevokeToken revoke a token, the requests with it get 401 then
+func (s *Server) RevokeToken(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.Tokens[id]; ok {
+		t.Revoked = true
+	}
+}
+
+// RevokeAll revoke all the tokens issued so far
+func (s *Server) RevokeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.Tokens {
+		t.Revoked = true
+	}
+}
+
+// Count return how many "METHOD /path" requests were served
+func (s *Server) Count(methodPath string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Requests[methodPath]
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.Requests[r.Method+" "+r.URL.Path]++
+	s.requestSeq++
+	w.Header().Set("X-Openstack-Request-Id", fmt.Sprintf("req-%d", s.requestSeq))
+	s.mu.Unlock()
+
+	if s.OnRequest != nil {
+		s.OnRequest(r)
+	}
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case path == "":
+		s.rootVersions(w)
+	case path == "/v3":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"version": s.identityVersion()})
+	case path == "/v2.0":
+		s.identityVersionV2(w)
+	case path == "/v2.0/tokens" && r.Method == http.MethodPost:
+		s.authTokensV2(w, r)
+	case path == "/v3/auth/tokens" && r.Method == http.MethodPost:
+		s.authTokens(w, r)
+	case path == "/v3/auth/tokens" && (r.Method == http.MethodGet || r.Method == http.MethodDelete):
+		s.withToken(w, r, s.subjectToken)
+	case path == "/v3/services":
+		s.withToken(w, r, s.services)
+	case path == "/v3/endpoints":
+		s.withToken(w, r, s.endpoints)
+	case path == "/sda/versions":
+		s.serviceVersions(w)
+	case strings.HasPrefix(path, "/sda/v1/"):
+		s.withToken(w, r, s.resource)
+	default:
+		writeError(w, http.StatusNotFound, "not found: "+r.URL.Path)
+	}
+}
+
+func (s *Server) identityVersion() map[string]interface{} {
+	return map[string]interface{}{
+		"id":     "v3.10",
+		"status": "stable",
+		"links":  []map[string]string{{"rel": "self", "href": s.IdentityURL() + "/"}},
+	}
+}
+
+func (s *Server) rootVersions(w http.ResponseWriter) {
+	writeJSON(w, http.StatusMultipleChoices, map[string]interface{}{
+		"versions": map[string]interface{}{
+			"values": []interface{}{s.identityVersion()},
+		},
+	})
+}
+
+func (s *Server) serviceVersions(w http.ResponseWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions := make([]interface{}, 0, len(s.ServiceVersions))
+	for _, v := range s.ServiceVersions {
+		versions = append(versions, map[string]interface{}{
+			"id":     v.ID,
+			"status": v.Status,
+			"links":  []map[string]string{{"rel": "self", "href": s.URL + v.Href}},
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"versions": versions})
+}
+
+// withToken serve the request only if X-Auth-Token is valid
+func (s *Server) withToken(w http.ResponseWriter, r *http.Request, h http.HandlerFunc) {
+	s.mu.Lock()
+	t, ok := s.Tokens[r.Header.Get("X-Auth-Token")]
+	valid := ok && !t.Revoked && time.Now().Before(t.ExpiresAt)
+	s.mu.Unlock()
+
+	if !valid {
+		writeError(w, http.StatusUnauthorized, "The request you have made requires authentication.")
+		return
+	}
+	h(w, r)
+}
+
+func (s *Server) resource(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/sda/v1/")
+
+	s.mu.Lock()
+	var h http.Handler
+	for prefix, handler := range s.handlers {
+		if rest == prefix || strings.HasPrefix(rest, prefix+"/") {
+			h = handler
+		}
+	}
+	s.mu.Unlock()
+
+	if h == nil {
+		writeError(w, http.StatusNotFound, "no resource api at "+r.URL.Path)
+		return
+	}
+	http.StripPrefix("/sda/v1", h).ServeHTTP(w, r)
+}
+
+func (s *Server) services(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	services := make([]interface{}, 0, len(s.Services))
+	for _, svc := range s.Services {
+		services = append(services, map[string]interface{}{
+			"id":          svc.ID,
+			"name":        svc.Name,
+			"type":        svc.Type,
+			"enabled":     svc.Enabled,
+			"description": "",
+			"links":       map[string]string{"self": s.IdentityURL() + "/services/" + svc.ID},
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"services": services,
+		"links":    map[string]interface{}{"self": s.IdentityURL() + "/services", "next": nil},
+	})
+}
+
+func (s *Server) endpoints(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	serviceID := r.URL.Query().Get("service_id")
+	endpoints := []interface{}{}
+	for _, svc := range s.Services {
+		if serviceID != "" && svc.ID != serviceID {
+			continue
+		}
+		for _, ep := range svc.Endpoints {
+			endpoints = append(endpoints, map[string]interface{}{
+				"id":         ep.ID,
+				"interface":  ep.Interface,
+				"region":     ep.Region,
+				"region_id":  ep.Region,
+				"url":        s.absURL(ep.URL),
+				"enabled":    ep.Enabled,
+				"service_id": svc.ID,
+				"links":      map[string]string{"self": s.IdentityURL() + "/endpoints/" + ep.ID},
+			})
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"endpoints": endpoints,
+		"links":     map[string]interface{}{"self": s.IdentityURL() + "/endpoints", "next": nil},
+	})
+}
+
+func (s *Server) absURL(u string) string {
+	if strings.HasPrefix(u, "/") {
+		return s.URL + u
+	}
+	return u
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    status,
+			"title":   http.StatusText(status),
+			"message": msg,
+		},
+	})
+}
+
+func (s *Server) nextID(prefix string) string {
+	s.seq++
+	return fmt.Sprintf("%s-%d", prefix, s.seq)
+}
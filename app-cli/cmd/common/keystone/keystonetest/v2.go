@@ -0,0 +1,112 @@
+package keystonetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"golang/app-cli/cmd/common/keystone"
+)
+
+// the v2.0 api sees the users and projects of the default domain only
+var defaultDomainV2 = &keystone.Domain{Name: DefaultDomain}
+
+// identityVersionV2 the document of GET /v2.0
+func (s *Server) identityVersionV2(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"version": map[string]interface{}{
+			"id":     "v2.0",
+			"status": "deprecated",
+			"links":  []map[string]string{{"rel": "self", "href": s.URL + "/v2.0/"}},
+		},
+	})
+}
+
+// authTokensV2 issue a token by the passwordCredentials of a POST /v2.0/tokens
+// request, scoped to its tenant
+func (s *Server) authTokensV2(w http.ResponseWriter, r *http.Request) {
+	req := struct {
+		Auth struct {
+			PasswordCredentials *struct {
+				Username string `json:"username"`
+				UserID   string `json:"userId"`
+				Password string `json:"password"`
+			} `json:"passwordCredentials"`
+			TenantName string `json:"tenantName"`
+			TenantID   string `json:"tenantId"`
+		} `json:"auth"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid auth request: "+err.Error())
+		return
+	}
+	creds := req.Auth.PasswordCredentials
+	if creds == nil {
+		writeError(w, http.StatusBadRequest, "unsupported auth methods")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.findUser(keystone.User{ID: creds.UserID, Name: creds.Username, Domain: defaultDomainV2})
+	if user == nil || user.Password != creds.Password {
+		writeError(w, http.StatusUnauthorized, "The request you have made requires authentication.")
+		return
+	}
+
+	var tenant map[string]interface{}
+	projectID := ""
+	if req.Auth.TenantName != "" || req.Auth.TenantID != "" {
+		p := s.findProject(&keystone.Project{ID: req.Auth.TenantID, Name: req.Auth.TenantName, Domain: defaultDomainV2})
+		if p == nil || !member(user, p.ID) {
+			writeError(w, http.StatusUnauthorized, "User has no access to tenant.")
+			return
+		}
+		projectID = p.ID
+		tenant = map[string]interface{}{"id": p.ID, "name": p.Name}
+	}
+
+	t := s.issue(user.ID, projectID, "", []string{"password"})
+
+	// a v2.0 endpoint carries the urls of all the interfaces of a region
+	catalog := []interface{}{}
+	if projectID != "" && !s.NoCatalog {
+		for _, svc := range s.Services {
+			if !svc.Enabled {
+				continue
+			}
+			byRegion := map[string]map[string]interface{}{}
+			var endpoints []interface{}
+			for _, ep := range svc.Endpoints {
+				if !ep.Enabled {
+					continue
+				}
+				e, ok := byRegion[ep.Region]
+				if !ok {
+					e = map[string]interface{}{"id": ep.ID, "region": ep.Region}
+					byRegion[ep.Region] = e
+					endpoints = append(endpoints, e)
+				}
+				e[ep.Interface+"URL"] = s.absURL(ep.URL)
+			}
+			catalog = append(catalog, map[string]interface{}{
+				"name":      svc.Name,
+				"type":      svc.Type,
+				"endpoints": endpoints,
+			})
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access": map[string]interface{}{
+			"token": map[string]interface{}{
+				"id":      t.ID,
+				"expires": t.ExpiresAt.Format(time.RFC3339),
+				"tenant":  tenant,
+			},
+			"user":           map[string]interface{}{"id": user.ID, "name": user.Name},
+			"serviceCatalog": catalog,
+		},
+	})
+}
@@ -0,0 +1,105 @@
+package keystone
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Token keystone token and the metadata issued with it
+type Token struct {
+	ID        string    `json:"id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	IssuedAt  time.Time `json:"issued_at"`
+	Methods   []string  `json:"methods,omitempty"`
+	User      *Owner    `json:"user,omitempty"`
+	// Project or Domain the scope, none for an unscoped token
+	Project *Owner  `json:"project,omitempty"`
+	Domain  *Domain `json:"domain,omitempty"`
+	Roles   []Role  `json:"roles,omitempty"`
+	Catalog Catalog `json:"catalog,omitempty"`
+}
+
+// Owner the user or project of a token, with its domain
+type Owner struct {
+	ID     string  `json:"id"`
+	Name   string  `json:"name"`
+	Domain *Domain `json:"domain,omitempty"`
+}
+
+// Role a role granted by the token
+type Role struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Catalog the services catalog scoped to the token
+type Catalog []CatalogService
+
+// CatalogService a service in the catalog
+type CatalogService struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Type      string            `json:"type"`
+	Endpoints []CatalogEndpoint `json:"endpoints"`
+}
+
+// CatalogEndpoint a service endpoint in the catalog
+type CatalogEndpoint struct {
+	ID        string `json:"id"`
+	Interface string `json:"interface"`
+	Region    string `json:"region"`
+	RegionID  string `json:"region_id"`
+	URL       string `json:"url"`
+}
+
+// Service return the named service in the catalog
+func (c Catalog) Service(name string) (CatalogService, bool) {
+	for _, s := range c {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return CatalogService{}, false
+}
+
+// tokenBody the body of a POST /auth/tokens response
+type tokenBody struct {
+	Token struct {
+		ExpiresAt time.Time `json:"expires_at"`
+		IssuedAt  time.Time `json:"issued_at"`
+		Methods   []string  `json:"methods"`
+		User      *Owner    `json:"user"`
+		Project   *Owner    `json:"project"`
+		Domain    *Domain   `json:"domain"`
+		Roles     []Role    `json:"roles"`
+		Catalog   Catalog   `json:"catalog"`
+	} `json:"token"`
+}
+
+// ValidFor report whether the token is still usable for at least d
+func (t *Token) ValidFor(d time.Duration) bool {
+	if t == nil || t.ID == "" || t.ExpiresAt.IsZero() {
+		return false
+	}
+	return time.Now().Add(d).Before(t.ExpiresAt)
+}
+
+func parseToken(id string, body []byte) (*Token, error) {
+	tb := tokenBody{}
+	if err := json.Unmarshal(body, &tb); err != nil {
+		return nil, fmt.Errorf("invalid token response: %s", err)
+	}
+
+	return &Token{
+		ID:        id,
+		ExpiresAt: tb.Token.ExpiresAt,
+		IssuedAt:  tb.Token.IssuedAt,
+		Methods:   tb.Token.Methods,
+		User:      tb.Token.User,
+		Project:   tb.Token.Project,
+		Domain:    tb.Token.Domain,
+		Roles:     tb.Token.Roles,
+		Catalog:   tb.Token.Catalog,
+	}, nil
+}
@@ -0,0 +1,150 @@
+package keystone
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ClientV2 the keystone v2.0 identity api client
+type ClientV2 struct {
+	*Client
+}
+
+// NewClientV2 use to new a v2.0 client, url is like http://keystone:5000/v2.0
+func NewClientV2(url string) (*ClientV2, error) {
+	c, err := NewClient(url)
+	if err != nil {
+		return nil, err
+	}
+	return &ClientV2{Client: c}, nil
+}
+
+// Version the identity api version
+func (c *ClientV2) Version() string {
+	return "2.0"
+}
+
+type passwordCredentialsV2 struct {
+	Username string `json:"username,omitempty"`
+	UserID   string `json:"userId,omitempty"`
+	Password string `json:"password"`
+}
+
+type authV2 struct {
+	PasswordCredentials *passwordCredentialsV2 `json:"passwordCredentials,omitempty"`
+	Token               *TokenID               `json:"token,omitempty"`
+	TenantName          string                 `json:"tenantName,omitempty"`
+	TenantID            string                 `json:"tenantId,omitempty"`
+}
+
+type accessV2 struct {
+	Access struct {
+		Token struct {
+			ID        string    `json:"id"`
+			ExpiresAt time.Time `json:"expires"`
+		} `json:"token"`
+		ServiceCatalog []struct {
+			Name      string `json:"name"`
+			Type      string `json:"type"`
+			Endpoints []struct {
+				ID          string `json:"id"`
+				Region      string `json:"region"`
+				PublicURL   string `json:"publicURL"`
+				InternalURL string `json:"internalURL"`
+				AdminURL    string `json:"adminURL"`
+			} `json:"endpoints"`
+		} `json:"serviceCatalog"`
+	} `json:"access"`
+}
+
+// toV2 map the v3 auth to v2.0, which has no domains and knows
+// projects as tenants
+func toV2(auth Auth) (authV2, error) {
+	a := authV2{}
+
+	switch {
+	case auth.Identity.Password != nil:
+		u := auth.Identity.Password.User
+		a.PasswordCredentials = &passwordCredentialsV2{
+			Username: u.Name,
+			UserID:   u.ID,
+			Password: u.Password,
+		}
+	case auth.Identity.Token != nil:
+		a.Token = auth.Identity.Token
+	default:
+		return a, fmt.Errorf("identity api v2.0 does not support the %v auth method", auth.Identity.Methods)
+	}
+
+	if auth.Scope != nil {
+		if auth.Scope.Project == nil {
+			return a, errors.New("identity api v2.0 does not support domain scoped tokens")
+		}
+		a.TenantName = auth.Scope.Project.Name
+		a.TenantID = auth.Scope.Project.ID
+	}
+
+	return a, nil
+}
+
+// GetToken issue a token by POST /tokens
+func (c *ClientV2) GetToken(ctx context.Context, auth Auth) (*Token, error) {
+	a, err := toV2(auth)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonStr, err := json.Marshal(map[string]authV2{"auth": a})
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth request: %s", err)
+	}
+
+	resp, err := c.doRequest(ctx, request{
+		URL:          fmt.Sprintf("%s/tokens", c.URL),
+		Method:       http.MethodPost,
+		Body:         jsonStr,
+		OkStatusCode: http.StatusOK,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	access := accessV2{}
+	if err := json.Unmarshal(resp.Body, &access); err != nil {
+		return nil, fmt.Errorf("invalid token response: %s", err)
+	}
+	if access.Access.Token.ID == "" {
+		return nil, errors.New("No token found in response")
+	}
+
+	token := &Token{
+		ID:        access.Access.Token.ID,
+		ExpiresAt: access.Access.Token.ExpiresAt,
+	}
+
+	// split every v2.0 endpoint into the v3 style one per interface
+	for _, s := range access.Access.ServiceCatalog {
+		service := CatalogService{Name: s.Name, Type: s.Type}
+		for _, ep := range s.Endpoints {
+			urls := []string{ep.PublicURL, ep.InternalURL, ep.AdminURL}
+			for i, iface := range []string{"public", "internal", "admin"} {
+				if urls[i] == "" {
+					continue
+				}
+				service.Endpoints = append(service.Endpoints, CatalogEndpoint{
+					ID:        ep.ID,
+					Interface: iface,
+					Region:    ep.Region,
+					URL:       urls[i],
+				})
+			}
+		}
+		token.Catalog = append(token.Catalog, service)
+	}
+
+	return token, nil
+}
@@ -0,0 +1,218 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"golang/app-cli/cmd/common/printer"
+)
+
+// Page one page of a list
+type Page struct {
+	// Body the raw response body
+	Body []byte
+	// Items the decoded items under the list key
+	Items []interface{}
+}
+
+// Pager walk the pages of a list, following the "links.next" or
+// "<key>_links" next link when the api returns one, and asking the
+// page after the last item by marker/limit otherwise
+type Pager struct {
+	Client *Client
+	// URL the list url, the query parameters are kept on every page
+	URL string
+	// Key the json key of the list, eg: resourceAs
+	Key string
+	// IDField the field sent as the marker, "id" if not set
+	IDField string
+
+	// PageSize how many items each page asks for, 0 leaves it to the api
+	PageSize int
+	// Limit stop after this many items, 0 means no limit
+	Limit int
+	// Marker start after the item of this id
+	Marker string
+	// All follow the pages until the end, only the first page is read
+	// if neither All nor Limit is set
+	All bool
+
+	// More is set when the walk stopped before the last page
+	More bool
+	// Last the id of the last item read, the marker of the next page
+	Last string
+}
+
+// EachPage read the pages and call fn with each one as it comes
+func (p *Pager) EachPage(ctx context.Context, fn func(*Page) error) error {
+	next, err := p.firstURL()
+	if err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+	count := 0
+	for next != "" {
+		if seen[next] {
+			return fmt.Errorf("the list of %s loops back to %s", p.Key, next)
+		}
+		seen[next] = true
+
+		resp, err := p.Client.DoRequest(ctx, Request{
+			URL:          next,
+			Method:       http.MethodGet,
+			OkStatusCode: http.StatusOK,
+		})
+		if err != nil {
+			return err
+		}
+
+		page, link, err := p.decode(resp.Body, next)
+		if err != nil {
+			return err
+		}
+
+		if p.Limit > 0 && count+len(page.Items) > p.Limit {
+			page.Items = page.Items[:p.Limit-count]
+		}
+		count += len(page.Items)
+		if len(page.Items) != 0 {
+			p.Last = p.id(page.Items[len(page.Items)-1])
+		}
+
+		if err := fn(page); err != nil {
+			return err
+		}
+
+		if link == "" {
+			link = p.markerURL(next, len(page.Items), count)
+		}
+		p.More = link != ""
+
+		if (p.Limit > 0 && count >= p.Limit) || (p.Limit == 0 && !p.All) {
+			break
+		}
+		next = link
+	}
+
+	return nil
+}
+
+// firstURL the list url with the limit and marker
+func (p *Pager) firstURL() (string, error) {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	if n := p.pageLimit(0); n > 0 {
+		q.Set("limit", strconv.Itoa(n))
+	}
+	if p.Marker != "" {
+		q.Set("marker", p.Marker)
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// pageLimit the limit to ask for when count items are read
+func (p *Pager) pageLimit(count int) int {
+	n := p.PageSize
+	if p.Limit > 0 && (n == 0 || p.Limit-count < n) {
+		n = p.Limit - count
+	}
+	return n
+}
+
+// markerURL the url of the page after the last item, the api has no
+// more when it returned less than asked, or when nothing was asked
+func (p *Pager) markerURL(current string, n, count int) string {
+	u, err := url.Parse(current)
+	if err != nil || p.Last == "" {
+		return ""
+	}
+
+	q := u.Query()
+	asked, _ := strconv.Atoi(q.Get("limit"))
+	if asked == 0 || n < asked {
+		return ""
+	}
+
+	q.Set("marker", p.Last)
+	if limit := p.pageLimit(count); limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// decode the page and its next link, resolved against the page url
+func (p *Pager) decode(body []byte, current string) (*Page, string, error) {
+	obj, err := printer.Decode(body)
+	if err != nil {
+		return nil, "", err
+	}
+	doc, ok := obj.(map[string]interface{})
+	if !ok {
+		return nil, "", fmt.Errorf("invalid response body, want an object with %q", p.Key)
+	}
+
+	items, ok := doc[p.Key].([]interface{})
+	if !ok && doc[p.Key] != nil {
+		return nil, "", fmt.Errorf("invalid response body, %q is not a list", p.Key)
+	}
+
+	link := nextLink(doc, p.Key)
+	if link != "" {
+		base, err := url.Parse(current)
+		if err != nil {
+			return nil, "", err
+		}
+		ref, err := url.Parse(link)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid next link %q: %s", link, err)
+		}
+		link = base.ResolveReference(ref).String()
+	}
+
+	return &Page{Body: body, Items: items}, link, nil
+}
+
+func (p *Pager) id(item interface{}) string {
+	field := p.IDField
+	if field == "" {
+		field = "id"
+	}
+	if m, ok := item.(map[string]interface{}); ok && m[field] != nil {
+		return fmt.Sprint(m[field])
+	}
+	return ""
+}
+
+// nextLink find the next link, either keystone style {"links": {"next": url}}
+// or nova style {"<key>_links": [{"rel": "next", "href": url}]}
+func nextLink(doc map[string]interface{}, key string) string {
+	if links, ok := doc["links"].(map[string]interface{}); ok {
+		if next, ok := links["next"].(string); ok {
+			return next
+		}
+	}
+
+	for _, k := range []string{key + "_links", "links"} {
+		links, _ := doc[k].([]interface{})
+		for _, l := range links {
+			m, _ := l.(map[string]interface{})
+			if m["rel"] == "next" {
+				href, _ := m["href"].(string)
+				return href
+			}
+		}
+	}
+
+	return ""
+}
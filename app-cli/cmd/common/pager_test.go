@@ -0,0 +1,62 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// an api paging by marker/limit only, without next links
+func TestPagerMarker(t *testing.T) {
+	ids := []string{"1", "2", "3", "4", "5"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		start := 0
+		if m := r.URL.Query().Get("marker"); m != "" {
+			start, _ = strconv.Atoi(m)
+		}
+		items := []map[string]string{}
+		for _, id := range ids[start:] {
+			if limit > 0 && len(items) == limit {
+				break
+			}
+			items = append(items, map[string]string{"id": id})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"things": items})
+	}))
+	defer srv.Close()
+
+	client, _ := NewClient(srv.URL, "token")
+	for _, c := range []struct {
+		pager Pager
+		want  int
+		pages int
+		more  bool
+	}{
+		{Pager{PageSize: 2, All: true}, 5, 3, false},
+		{Pager{PageSize: 2, Limit: 3}, 3, 2, true},
+		{Pager{PageSize: 5, All: true}, 5, 2, false},
+		{Pager{PageSize: 2, Marker: "4"}, 1, 1, false},
+		{Pager{}, 5, 1, false},
+	} {
+		p := c.pager
+		p.Client, p.URL, p.Key = client, srv.URL+"/things", "things"
+
+		got, pages := 0, 0
+		err := p.EachPage(context.Background(), func(page *Page) error {
+			got += len(page.Items)
+			pages++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want || pages != c.pages || p.More != c.more {
+			t.Errorf("%+v: want %d items in %d pages more=%v, got %d in %d more=%v",
+				c.pager, c.want, c.pages, c.more, got, pages, p.More)
+		}
+	}
+}
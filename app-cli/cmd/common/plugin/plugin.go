@@ -0,0 +1,93 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Prefix the executables named app-cli-<name> are the plugin <name>
+const Prefix = "app-cli-"
+
+// DirEnv the environment variable listing the plugin directories,
+// searched before PATH, DefaultDir if not set
+const DirEnv = "APP_CLI_PLUGINS_DIR"
+
+// Plugin an executable found in the search path
+type Plugin struct {
+	Name string
+	Path string
+	// ShadowedBy the path of the plugin of the same name found first,
+	// empty if this one is used
+	ShadowedBy string
+}
+
+// DefaultDir the plugin directory in the user config dir
+func DefaultDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "app-cli", "plugins")
+}
+
+// Dirs the plugin directories then the PATH ones
+func Dirs() []string {
+	dirs := filepath.SplitList(os.Getenv(DirEnv))
+	if len(dirs) == 0 {
+		dirs = []string{DefaultDir()}
+	}
+	return append(dirs, filepath.SplitList(os.Getenv("PATH"))...)
+}
+
+// Discover find the plugins in the dirs, in order, so the first one
+// of a name is used and the later ones are shadowed by it
+func Discover(dirs []string) []Plugin {
+	var (
+		plugins []Plugin
+		first   = map[string]string{}
+		seen    = map[string]bool{}
+	)
+	for _, dir := range dirs {
+		if dir == "" || seen[dir] {
+			continue
+		}
+		seen[dir] = true
+
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+		for _, e := range entries {
+			name := strings.TrimPrefix(e.Name(), Prefix)
+			if name == e.Name() || name == "" || !executable(dir, e) {
+				continue
+			}
+
+			p := Plugin{Name: name, Path: filepath.Join(dir, e.Name())}
+			if path, ok := first[name]; ok {
+				p.ShadowedBy = path
+			} else {
+				first[name] = p.Path
+			}
+			plugins = append(plugins, p)
+		}
+	}
+	return plugins
+}
+
+// executable a regular file, or a link to one, with an exec bit
+func executable(dir string, e os.FileInfo) bool {
+	info := e
+	if e.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if info, err = os.Stat(filepath.Join(dir, e.Name())); err != nil {
+			return false
+		}
+	}
+	return info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0
+}
@@ -0,0 +1,333 @@
+package printer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSONPathPrinter print the object by a kubectl style jsonpath template,
+// eg: {.id}, {.items[*].name} or {range .items[*]}{.id}{"\n"}{end}. A path
+// matching nothing is an error, as kubectl does. The recursive descent,
+// slices, filters and unions are not supported
+type JSONPathPrinter struct {
+	nodes []jpNode
+}
+
+type jpStep struct {
+	field string
+	index int
+	all   bool
+	isIdx bool
+}
+
+func (s jpStep) String() string {
+	switch {
+	case s.all:
+		return "[*]"
+	case s.isIdx:
+		return fmt.Sprintf("[%d]", s.index)
+	}
+	return s.field
+}
+
+type jpNode struct {
+	kind int
+	text string
+	path []jpStep
+	body []jpNode
+}
+
+const (
+	jpText = iota
+	jpPath
+	jpRange
+	jpEnd
+)
+
+// NewJSONPathPrinter use to new a jsonpath printer, an expression without
+// braces like ".id" is taken as "{.id}"
+func NewJSONPathPrinter(expr string) (*JSONPathPrinter, error) {
+	if expr == "" {
+		return nil, fmt.Errorf("jsonpath output needs an expression, eg: -o jsonpath='{.id}'")
+	}
+	if !strings.Contains(expr, "{") {
+		expr = "{" + expr + "}"
+	}
+
+	tokens, err := jpTokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, rest, err := jpBuild(tokens)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("invalid jsonpath %q: unexpected {end}", expr)
+	}
+
+	return &JSONPathPrinter{nodes: nodes}, nil
+}
+
+// PrintObj print the object by the jsonpath template, a newline is
+// added if the template does not end with one
+func (p *JSONPathPrinter) PrintObj(obj interface{}, w io.Writer) error {
+	buf := &bytes.Buffer{}
+	if err := jpExec(p.nodes, obj, buf); err != nil {
+		return err
+	}
+	if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteString("\n")
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func jpTokenize(expr string) ([]jpNode, error) {
+	var tokens []jpNode
+
+	for len(expr) > 0 {
+		start := strings.Index(expr, "{")
+		if start < 0 {
+			tokens = append(tokens, jpNode{kind: jpText, text: expr})
+			break
+		}
+		if start > 0 {
+			tokens = append(tokens, jpNode{kind: jpText, text: expr[:start]})
+		}
+
+		end := jpClose(expr, start)
+		if end < 0 {
+			return nil, fmt.Errorf("invalid jsonpath %q: unclosed {", expr)
+		}
+
+		inner := strings.TrimSpace(expr[start+1 : end])
+		expr = expr[end+1:]
+
+		switch {
+		case inner == "end":
+			tokens = append(tokens, jpNode{kind: jpEnd})
+		case strings.HasPrefix(inner, "range "):
+			path, err := jpParsePath(strings.TrimSpace(inner[len("range "):]))
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, jpNode{kind: jpRange, path: path})
+		case strings.HasPrefix(inner, `"`):
+			text, err := strconv.Unquote(inner)
+			if err != nil {
+				return nil, fmt.Errorf("invalid jsonpath string %s: %s", inner, err)
+			}
+			tokens = append(tokens, jpNode{kind: jpText, text: text})
+		default:
+			path, err := jpParsePath(inner)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, jpNode{kind: jpPath, path: path})
+		}
+	}
+
+	return tokens, nil
+}
+
+// jpClose find the "}" closing the "{" at start, braces in strings are skipped
+func jpClose(expr string, start int) int {
+	inString := false
+	for i := start + 1; i < len(expr); i++ {
+		switch expr[i] {
+		case '\\':
+			if inString {
+				i++
+			}
+		case '"':
+			inString = !inString
+		case '}':
+			if !inString {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// jpBuild nest the tokens between {range} and {end}
+func jpBuild(tokens []jpNode) ([]jpNode, []jpNode, error) {
+	var nodes []jpNode
+
+	for len(tokens) > 0 {
+		t := tokens[0]
+		tokens = tokens[1:]
+
+		switch t.kind {
+		case jpEnd:
+			return nodes, append([]jpNode{t}, tokens...), nil
+		case jpRange:
+			body, rest, err := jpBuild(tokens)
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(rest) == 0 {
+				return nil, nil, fmt.Errorf("invalid jsonpath: {range} without {end}")
+			}
+			t.body = body
+			tokens = rest[1:]
+		}
+		nodes = append(nodes, t)
+	}
+
+	return nodes, nil, nil
+}
+
+func jpParsePath(s string) ([]jpStep, error) {
+	orig := s
+	s = strings.TrimPrefix(s, "$")
+
+	var steps []jpStep
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			n := strings.IndexAny(s, ".[")
+			if n < 0 {
+				n = len(s)
+			}
+			field := s[:n]
+			s = s[n:]
+			switch field {
+			case "":
+				if strings.HasPrefix(s, ".") {
+					return nil, fmt.Errorf("invalid jsonpath %q: the recursive descent .. is not supported", orig)
+				}
+				// "." alone is the current object
+			case "*":
+				steps = append(steps, jpStep{all: true})
+			default:
+				steps = append(steps, jpStep{field: field})
+			}
+		case '[':
+			n := strings.Index(s, "]")
+			if n < 0 {
+				return nil, fmt.Errorf("invalid jsonpath %q: unclosed [", orig)
+			}
+			inner := strings.TrimSpace(s[1:n])
+			s = s[n+1:]
+
+			switch {
+			case inner == "*":
+				steps = append(steps, jpStep{all: true})
+			case jpQuoted(inner):
+				steps = append(steps, jpStep{field: inner[1 : len(inner)-1]})
+			case strings.HasPrefix(inner, "?"):
+				return nil, fmt.Errorf("invalid jsonpath %q: the filter [%s] is not supported", orig, inner)
+			case strings.Contains(inner, ","):
+				return nil, fmt.Errorf("invalid jsonpath %q: the union [%s] is not supported", orig, inner)
+			case strings.Contains(inner, ":"):
+				return nil, fmt.Errorf("invalid jsonpath %q: the slice [%s] is not supported", orig, inner)
+			default:
+				i, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid jsonpath %q: bad index [%s]", orig, inner)
+				}
+				steps = append(steps, jpStep{index: i, isIdx: true})
+			}
+		default:
+			return nil, fmt.Errorf("invalid jsonpath %q: unexpected %q", orig, s[0])
+		}
+	}
+
+	return steps, nil
+}
+
+// jpQuoted the field name is a single quoted string, eg: 'a.b' but not 'a','b'
+func jpQuoted(s string) bool {
+	if len(s) < 2 || (s[0] != '\'' && s[0] != '"') {
+		return false
+	}
+	return s[len(s)-1] == s[0] && strings.Count(s, s[:1]) == 2
+}
+
+// jpEval return all the values the path matched in obj, a field or an
+// index matching nothing is not found, [*] of an empty list is not
+func jpEval(path []jpStep, obj interface{}) ([]interface{}, error) {
+	values := []interface{}{obj}
+
+	for _, step := range path {
+		var next []interface{}
+		for _, v := range values {
+			switch v := v.(type) {
+			case map[string]interface{}:
+				if step.all {
+					keys := make([]string, 0, len(v))
+					for k := range v {
+						keys = append(keys, k)
+					}
+					sort.Strings(keys)
+					for _, k := range keys {
+						next = append(next, v[k])
+					}
+				} else if f, ok := v[step.field]; ok && !step.isIdx {
+					next = append(next, f)
+				}
+			case []interface{}:
+				switch {
+				case step.all:
+					next = append(next, v...)
+				case step.isIdx:
+					i := step.index
+					if i < 0 {
+						i += len(v)
+					}
+					if i >= 0 && i < len(v) {
+						next = append(next, v[i])
+					}
+				}
+			}
+		}
+		if len(next) == 0 && len(values) > 0 && !step.all {
+			return nil, fmt.Errorf("jsonpath: %s is not found", step)
+		}
+		values = next
+	}
+
+	return values, nil
+}
+
+func jpExec(nodes []jpNode, obj interface{}, w io.Writer) error {
+	for _, n := range nodes {
+		switch n.kind {
+		case jpText:
+			if _, err := io.WriteString(w, n.text); err != nil {
+				return err
+			}
+		case jpPath:
+			values, err := jpEval(n.path, obj)
+			if err != nil {
+				return err
+			}
+			cells := make([]string, 0, len(values))
+			for _, v := range values {
+				cells = append(cells, format(v))
+			}
+			if _, err := io.WriteString(w, strings.Join(cells, " ")); err != nil {
+				return err
+			}
+		case jpRange:
+			items, err := jpEval(n.path, obj)
+			if err != nil {
+				return err
+			}
+			for _, item := range items {
+				if err := jpExec(n.body, item, w); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package printer
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSONPath(t *testing.T) {
+	var obj interface{}
+	json.Unmarshal([]byte(`{
+		"id": "1",
+		"a": [{"b": "x", "c": null}, {"b": "y"}],
+		"m": {"k.1": "v", "k,2": "w"},
+		"empty": []
+	}`), &obj)
+
+	for _, c := range []struct {
+		expr, want, err string
+	}{
+		{"{.id}", "1\n", ""},
+		{".id", "1\n", ""},
+		{"{.a[*].b}", "x y\n", ""},
+		{"{.a[-1].b}", "y\n", ""},
+		{"{$.a[0]['b']}", "x\n", ""},
+		{"{.m['k.1']} {.m[\"k,2\"]}", "v w\n", ""},
+		{"{range .a[*]}{.b}{\"\\n\"}{end}", "x\ny\n", ""},
+		{"{.empty[*]}", "", ""},
+		{"{.a[0].c}", "", ""},
+		// matching nothing
+		{"{.missing}", "", "missing is not found"},
+		{"{.a['b']}", "", "b is not found"},
+		{"{.a[5].b}", "", "[5] is not found"},
+		{"{.id.x}", "", "x is not found"},
+		{"{range .a[*]}{.c}{end}", "", "c is not found"},
+	} {
+		p, err := NewJSONPathPrinter(c.expr)
+		if err == nil {
+			out := &bytes.Buffer{}
+			if err = p.PrintObj(obj, out); err == nil && out.String() != c.want {
+				t.Errorf("%s: want %q, got %q", c.expr, c.want, out)
+			}
+		}
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("%s: %s", c.expr, err)
+		case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+			t.Errorf("%s: want an error with %q, got %v", c.expr, c.err, err)
+		}
+	}
+}
+
+// the syntax not supported is rejected when parsed, before any request
+func TestJSONPathUnsupported(t *testing.T) {
+	for expr, want := range map[string]string{
+		"{..b}":             "recursive descent",
+		"{.a[0:1]}":         "slice",
+		"{.a[::2]}":         "slice",
+		"{.a[?(@.b=='x')]}": "filter",
+		"{.a[0,1]}":         "union",
+		"{.m['k.1','k,2']}": "union",
+		"{.a[x]}":           "bad index",
+		"{.a":               "unclosed {",
+		"{range .a[*]}{.b}": "without {end}",
+		"{.a}{end}":         "unexpected {end}",
+	} {
+		if _, err := NewJSONPathPrinter(expr); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: want an error with %q, got %v", expr, want, err)
+		}
+	}
+}
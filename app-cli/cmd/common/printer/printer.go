@@ -0,0 +1,239 @@
+package printer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Formats the supported output formats, jsonpath and template take
+// their expression after a "=", eg: -o jsonpath={.id}
+var Formats = []string{"table", "json", "yaml", "jsonpath=EXPR", "template=TEMPLATE"}
+
+// Printer print the objects decoded from the api responses
+type Printer interface {
+	PrintObj(obj interface{}, w io.Writer) error
+}
+
+// New use to new the printer of the output format, columns are the
+// table columns, which also can be a dotted path like "status.phase"
+func New(output string, columns []string) (Printer, error) {
+	format, arg := output, ""
+	if i := strings.Index(output, "="); i >= 0 {
+		format, arg = output[:i], output[i+1:]
+	}
+
+	switch format {
+	case "", "table":
+		return &TablePrinter{Columns: columns}, nil
+	case "json":
+		return &JSONPrinter{}, nil
+	case "yaml":
+		return &YAMLPrinter{}, nil
+	case "jsonpath":
+		return NewJSONPathPrinter(arg)
+	case "template", "go-template":
+		return NewTemplatePrinter(arg)
+	}
+
+	return nil, fmt.Errorf("unknown output format %q, must be one of %s",
+		output, strings.Join(Formats, ", "))
+}
+
+// Decode decode the api response body, the numbers are kept as they are
+func Decode(body []byte) (interface{}, error) {
+	var obj interface{}
+
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if err := d.Decode(&obj); err != nil {
+		return nil, fmt.Errorf("invalid response body: %s", err)
+	}
+
+	return obj, nil
+}
+
+// JSONPrinter print the object as indented json
+type JSONPrinter struct{}
+
+// PrintObj print the object as indented json
+func (p *JSONPrinter) PrintObj(obj interface{}, w io.Writer) error {
+	data, err := json.MarshalIndent(obj, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// YAMLPrinter print the object as yaml
+type YAMLPrinter struct{}
+
+// PrintObj print the object as yaml
+func (p *YAMLPrinter) PrintObj(obj interface{}, w io.Writer) error {
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// TemplatePrinter print the object by a go template
+type TemplatePrinter struct {
+	tpl *template.Template
+}
+
+// NewTemplatePrinter use to new a go template printer
+func NewTemplatePrinter(text string) (*TemplatePrinter, error) {
+	if text == "" {
+		return nil, fmt.Errorf("template output needs a template, eg: -o template='{{.id}}'")
+	}
+
+	tpl, err := template.New("output").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %s", err)
+	}
+
+	return &TemplatePrinter{tpl: tpl}, nil
+}
+
+// PrintObj print the object by the template
+func (p *TemplatePrinter) PrintObj(obj interface{}, w io.Writer) error {
+	return p.tpl.Execute(w, obj)
+}
+
+// TablePrinter print a list of objects, or a single one, as a table.
+// Printing several times, eg: the pages of a list, prints the header
+// once and keeps the columns and their widths of the first rows, so the
+// rows stream aligned under the header, a longer cell pushes the next ones
+type TablePrinter struct {
+	Columns []string
+
+	widths []int
+}
+
+// tablePadding the spaces between the columns
+const tablePadding = 2
+
+// PrintObj print the object, each object in a list is a row
+func (p *TablePrinter) PrintObj(obj interface{}, w io.Writer) error {
+	var rows []interface{}
+	switch o := obj.(type) {
+	case []interface{}:
+		rows = o
+	default:
+		rows = []interface{}{o}
+	}
+
+	if len(p.Columns) == 0 {
+		p.Columns = keys(rows)
+	}
+	columns := p.Columns
+	if len(columns) == 0 {
+		// nothing to print, the columns come with the first rows
+		return nil
+	}
+
+	lines := make([][]string, 0, len(rows)+1)
+	if p.widths == nil {
+		header := make([]string, 0, len(columns))
+		for _, c := range columns {
+			header = append(header, strings.ToUpper(c))
+		}
+		lines = append(lines, header)
+	}
+	for _, row := range rows {
+		cells := make([]string, 0, len(columns))
+		for _, c := range columns {
+			cells = append(cells, format(lookup(row, c)))
+		}
+		lines = append(lines, cells)
+	}
+
+	if p.widths == nil {
+		p.widths = make([]int, len(columns))
+		for _, cells := range lines {
+			for i, cell := range cells {
+				if n := utf8.RuneCountInString(cell); n > p.widths[i] {
+					p.widths[i] = n
+				}
+			}
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	for _, cells := range lines {
+		pad := 0
+		for i, cell := range cells {
+			buf.WriteString(strings.Repeat(" ", pad))
+			buf.WriteString(cell)
+			pad = p.widths[i] - utf8.RuneCountInString(cell)
+			if pad < 0 {
+				pad = 0
+			}
+			pad += tablePadding
+		}
+		buf.WriteString("\n")
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// keys the sorted field names of the rows, used when no column is given
+func keys(rows []interface{}) []string {
+	set := map[string]bool{}
+	for _, row := range rows {
+		if m, ok := row.(map[string]interface{}); ok {
+			for k := range m {
+				set[k] = true
+			}
+		}
+	}
+
+	columns := make([]string, 0, len(set))
+	for k := range set {
+		columns = append(columns, k)
+	}
+	sort.Strings(columns)
+
+	return columns
+}
+
+// lookup the dotted path in the object
+func lookup(obj interface{}, path string) interface{} {
+	for _, field := range strings.Split(path, ".") {
+		m, ok := obj.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		obj = m[field]
+	}
+	return obj
+}
+
+// format a cell, nested objects are printed as compact json
+func format(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return fmt.Sprint(v)
+}
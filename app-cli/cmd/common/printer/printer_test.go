@@ -0,0 +1,64 @@
+package printer
+
+import (
+	"bytes"
+	"testing"
+)
+
+// the pages are printed under one header, in the columns of the first one
+func TestTablePages(t *testing.T) {
+	row := func(id, name string) interface{} {
+		return map[string]interface{}{"id": id, "name": name, "status": "ACTIVE"}
+	}
+	p := &TablePrinter{Columns: []string{"id", "name", "status"}}
+	out := &bytes.Buffer{}
+	for _, page := range [][]interface{}{
+		{row("1", "first"), row("2", "second")},
+		{row("3", "x")},
+		{row("10", "much-longer")},
+		{},
+	} {
+		if err := p.PrintObj(page, out); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "" +
+		"ID  NAME    STATUS\n" +
+		"1   first   ACTIVE\n" +
+		"2   second  ACTIVE\n" +
+		"3   x       ACTIVE\n" +
+		"10  much-longer  ACTIVE\n"
+	if out.String() != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, out)
+	}
+}
+
+func TestTableObject(t *testing.T) {
+	out := &bytes.Buffer{}
+	obj := map[string]interface{}{"b": map[string]interface{}{"c": "d"}, "a": nil, "é": "ü"}
+	if err := (&TablePrinter{}).PrintObj(obj, out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "A  B          É\n   {\"c\":\"d\"}  ü\n"; out.String() != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, out)
+	}
+}
+
+// no columns are known before the first rows
+func TestTableEmptyFirstPage(t *testing.T) {
+	p := &TablePrinter{}
+	out := &bytes.Buffer{}
+	for _, page := range [][]interface{}{
+		{},
+		{map[string]interface{}{"id": "1", "name": "first"}},
+		{map[string]interface{}{"id": "22", "name": "x"}},
+	} {
+		if err := p.PrintObj(page, out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := "ID  NAME\n1   first\n22  x\n"; out.String() != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, out)
+	}
+}
@@ -2,17 +2,40 @@ package common
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
+	"strconv"
+	"time"
+
+	"golang/app-cli/cmd/common/apierror"
 )
 
+// DefaultRequestTimeout the timeout of a single http request
+const DefaultRequestTimeout = 60 * time.Second
+
 type Request struct {
 	URL          string
 	Method       string
 	Body         []byte
 	OkStatusCode int
+	// OkStatusCodes the other status codes also accepted, eg: 202
+	OkStatusCodes []int
+}
+
+func (r Request) isOk(code int) bool {
+	if code == r.OkStatusCode {
+		return true
+	}
+	for _, c := range r.OkStatusCodes {
+		if code == c {
+			return true
+		}
+	}
+	return false
 }
 
 type Response struct {
@@ -21,29 +44,115 @@ type Response struct {
 	Headers    http.Header
 }
 
+// RetryPolicy how the idempotent requests are retried on connection
+// errors, 429 and 503, the delay grows exponentially with jitter. A
+// Retry-After of the server is followed up to MaxDelay
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// DefaultRetryPolicy the policy used by NewClient
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	BaseDelay:  500 * time.Millisecond,
+	MaxDelay:   30 * time.Second,
+}
+
+// HTTPClient is shared by all the clients, so connections are reused
+var HTTPClient = &http.Client{Timeout: DefaultRequestTimeout}
+
 type Client struct {
 	URL   string
 	Token string
+
+	// Headers the extra headers sent with every request
+	Headers http.Header
+
+	Retry RetryPolicy
+	// ReAuth is called with the token the server rejected, it returns
+	// a new token and the request is replayed once with it
+	ReAuth func(rejected string) (string, error)
 }
 
 func NewClient(url string, token string) (*Client, error) {
 	if url == "" {
 		return nil, errors.New("missing URL")
 	}
-	return &Client{URL: url, Token: token}, nil
+	return &Client{URL: url, Token: token, Retry: DefaultRetryPolicy}, nil
 }
 
-func (c *Client) DoRequest(r Request) (Response, error) {
-	client := &http.Client{}
+func (c *Client) DoRequest(ctx context.Context, r Request) (Response, error) {
+	resp, err := c.doWithRetry(ctx, r)
+	if err != nil {
+		return Response{}, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized && c.ReAuth != nil {
+		token, err := c.ReAuth(c.Token)
+		if err != nil {
+			return Response{}, fmt.Errorf("token rejected, re-authenticate failed: %w", err)
+		}
+		c.Token = token
 
-	req, err := http.NewRequest(r.Method, r.URL, bytes.NewBuffer(r.Body))
+		if resp, err = c.doWithRetry(ctx, r); err != nil {
+			return Response{}, err
+		}
+	}
+
+	if !r.isOk(resp.StatusCode) {
+		return Response{}, apierror.New(r.Method, r.URL, resp.StatusCode, resp.Headers, resp.Body)
+	}
+
+	return resp, nil
+}
+
+// doWithRetry send the request, retry it if it's idempotent and failed
+// by a connection error or a retryable status
+func (c *Client) doWithRetry(ctx context.Context, r Request) (Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.do(ctx, r)
+
+		retryable := err != nil ||
+			resp.StatusCode == http.StatusTooManyRequests ||
+			resp.StatusCode == http.StatusServiceUnavailable
+		if !retryable || !idempotent(r.Method) || attempt >= c.Retry.MaxRetries ||
+			ctx.Err() != nil {
+			return resp, err
+		}
+
+		delay := c.Retry.backoff(attempt)
+		if err == nil {
+			if after, ok := retryAfter(resp.Headers.Get("Retry-After")); ok {
+				delay = after
+			}
+			if delay > c.Retry.MaxDelay {
+				delay = c.Retry.MaxDelay
+			}
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return Response{}, ctx.Err()
+		}
+	}
+}
+
+func (c *Client) do(ctx context.Context, r Request) (Response, error) {
+	req, err := http.NewRequest(r.Method, r.URL, bytes.NewReader(r.Body))
 	if err != nil {
 		return Response{}, err
 	}
+	req = req.WithContext(ctx)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-Auth-Token", c.Token)
+	for k, v := range c.Headers {
+		req.Header[k] = v
+	}
 
-	resp, err := client.Do(req)
+	resp, err := HTTPClient.Do(req)
 	if err != nil {
 		return Response{}, err
 	}
@@ -54,12 +163,44 @@ func (c *Client) DoRequest(r Request) (Response, error) {
 		return Response{}, err
 	}
 
-	if resp.StatusCode != r.OkStatusCode {
-		return Response{}, fmt.Errorf("%s details: %s\n", resp.Status, body)
-	}
-
 	return Response{
 		Body:       body,
 		StatusCode: resp.StatusCode,
 		Headers:    resp.Header}, nil
 }
+
+// backoff the delay before the retry, the exponential delay is
+// jittered to 50%~100% so the clients do not retry all at once
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay << uint(attempt)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryAfter parse the Retry-After header, in seconds or a http date
+func retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang/app-cli/cmd/common/apierror"
+	"golang/app-cli/cmd/common/keystone/keystonetest"
+)
+
+// flaky answer status with Retry-After to the first fails requests, 200 then
+func flaky(status int, retryAfter string, fails int32) (http.Handler, *int32) {
+	var n int32
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&n, 1) <= fails {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}), &n
+}
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, max := range []time.Duration{
+		100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond,
+		800 * time.Millisecond, time.Second, time.Second,
+	} {
+		for i := 0; i < 20; i++ {
+			if d := p.backoff(attempt); d < max/2 || d > max {
+				t.Fatalf("backoff(%d) = %s, want %s~%s", attempt, d, max/2, max)
+			}
+		}
+	}
+	if d := p.backoff(64); d < p.MaxDelay/2 || d > p.MaxDelay {
+		t.Errorf("backoff overflow = %s, want capped by %s", d, p.MaxDelay)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	srv := keystonetest.NewServer()
+	defer srv.Close()
+	token := srv.IssueToken("u-alice", "p-demo")
+	policy := RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+	for _, c := range []struct {
+		method     string
+		status     int
+		retryAfter string
+		fails      int32
+		requests   int32
+		ok         bool
+	}{
+		{http.MethodGet, http.StatusServiceUnavailable, "", 2, 3, true},
+		{http.MethodPut, http.StatusTooManyRequests, "", 1, 2, true},
+		{http.MethodDelete, http.StatusServiceUnavailable, "", 1, 2, true},
+		// too many failures, the last response is returned
+		{http.MethodGet, http.StatusServiceUnavailable, "", 5, 3, false},
+		// never retried, they're not idempotent
+		{http.MethodPost, http.StatusServiceUnavailable, "", 1, 1, false},
+		{http.MethodPost, http.StatusTooManyRequests, "", 1, 1, false},
+		{http.MethodPatch, http.StatusServiceUnavailable, "", 1, 1, false},
+		// not a retryable status
+		{http.MethodGet, http.StatusInternalServerError, "", 1, 1, false},
+		// Retry-After is capped by MaxDelay, the test would hang otherwise
+		{http.MethodGet, http.StatusTooManyRequests, "3600", 1, 2, true},
+		{http.MethodGet, http.StatusServiceUnavailable, "Wed, 21 Oct 2099 07:28:00 GMT", 1, 2, true},
+	} {
+		h, n := flaky(c.status, c.retryAfter, c.fails)
+		srv.Handle("flaky", h)
+
+		client, _ := NewClient(srv.URL+"/sda/v1", token)
+		client.Retry = policy
+		start := time.Now()
+		_, err := client.DoRequest(context.Background(), Request{
+			URL: client.URL + "/flaky", Method: c.method, OkStatusCode: http.StatusOK,
+		})
+
+		if got := atomic.LoadInt32(n); got != c.requests {
+			t.Errorf("%s %d: want %d requests, got %d", c.method, c.status, c.requests, got)
+		}
+		var apiErr *apierror.APIError
+		if c.ok && err != nil {
+			t.Errorf("%s %d: want ok after the retries, got %s", c.method, c.status, err)
+		} else if !c.ok && (!errors.As(err, &apiErr) || apiErr.StatusCode != c.status) {
+			t.Errorf("%s %d: want the api error, got %v", c.method, c.status, err)
+		}
+		if took := time.Since(start); took > time.Second {
+			t.Errorf("%s %d: the retries took %s", c.method, c.status, took)
+		}
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	srv := keystonetest.NewServer()
+	defer srv.Close()
+	h, n := flaky(http.StatusServiceUnavailable, "", 10)
+	srv.Handle("flaky", h)
+
+	client, _ := NewClient(srv.URL+"/sda/v1", srv.IssueToken("u-alice", "p-demo"))
+	client.Retry = RetryPolicy{MaxRetries: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := client.DoRequest(ctx, Request{URL: client.URL + "/flaky", Method: http.MethodGet, OkStatusCode: http.StatusOK})
+	if err != context.DeadlineExceeded || atomic.LoadInt32(n) != 1 {
+		t.Errorf("want the wait for the retry canceled, got %v after %d requests", err, atomic.LoadInt32(n))
+	}
+}
+
+func TestReAuth(t *testing.T) {
+	srv := keystonetest.NewServer()
+	defer srv.Close()
+	h, _ := flaky(0, "", 0)
+	srv.Handle("things", h)
+
+	for _, c := range []struct {
+		name    string
+		revoke  bool // the new token is revoked too
+		wantErr int
+	}{
+		{"new token", false, 0},
+		{"rejected again", true, http.StatusUnauthorized},
+	} {
+		rejected := srv.IssueToken("u-alice", "p-demo")
+		srv.RevokeToken(rejected)
+		before := srv.Count("POST /sda/v1/things")
+
+		client, _ := NewClient(srv.URL+"/sda/v1", rejected)
+		calls := 0
+		client.ReAuth = func(token string) (string, error) {
+			calls++
+			if token != rejected {
+				t.Errorf("%s: want the rejected token, got %s", c.name, token)
+			}
+			next := srv.IssueToken("u-alice", "p-demo")
+			if c.revoke {
+				srv.RevokeToken(next)
+			}
+			return next, nil
+		}
+
+		_, err := client.DoRequest(context.Background(), Request{
+			URL: client.URL + "/things", Method: http.MethodPost, OkStatusCode: http.StatusOK,
+		})
+		var apiErr *apierror.APIError
+		switch {
+		case c.wantErr == 0 && err != nil:
+			t.Errorf("%s: want ok with the new token, got %s", c.name, err)
+		case c.wantErr != 0 && (!errors.As(err, &apiErr) || apiErr.StatusCode != c.wantErr):
+			t.Errorf("%s: want %d, got %v", c.name, c.wantErr, err)
+		}
+		if calls != 1 {
+			t.Errorf("%s: want 1 re-authentication, got %d", c.name, calls)
+		}
+		// the request is replayed once, even a POST
+		if n := srv.Count("POST /sda/v1/things") - before; n != 2 {
+			t.Errorf("%s: want the request sent twice, got %d", c.name, n)
+		}
+	}
+}
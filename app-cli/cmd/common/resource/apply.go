@@ -0,0 +1,319 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"golang/app-cli/cmd/common"
+)
+
+// the actions planned by apply
+const (
+	Create    = "create"
+	Update    = "update"
+	Delete    = "delete"
+	Unchanged = "unchanged"
+)
+
+// nameField the field identifying a manifest object without an id
+const nameField = "name"
+
+// Change a change planned for a resource
+type Change struct {
+	Action string
+	Def    *Definition
+	// ID the server id, empty for a create
+	ID   string
+	Name string
+	// Fields the fields sent by the create or update
+	Fields map[string]interface{}
+	// Diffs the changed fields of an update, eg: description: "a" -> "b"
+	Diffs  []string
+	Source string
+}
+
+func (c *Change) String() string {
+	target := c.Def.Name + " " + c.Name
+	if c.ID != "" {
+		target += " (" + c.ID + ")"
+	}
+
+	switch c.Action {
+	case Create:
+		return "+ " + target
+	case Update:
+		return "~ " + target + "\n    " + strings.Join(c.Diffs, "\n    ")
+	case Delete:
+		return "- " + target
+	}
+	return "= " + target
+}
+
+// Summary count the changes by action
+type Summary map[string]int
+
+func (s Summary) String() string {
+	return fmt.Sprintf("%d created, %d updated, %d deleted, %d unchanged",
+		s[Create], s[Update], s[Delete], s[Unchanged])
+}
+
+// Plan diff the manifest objects against the server, kinds map the kind
+// to its resource. The server resources of these kinds missing from the
+// manifests are deleted when prune is set
+func Plan(objs []Object, kinds map[string]*Definition, prune bool) ([]*Change, error) {
+	var (
+		order   []string
+		byKind  = map[string][]Object{}
+		changes []*Change
+		deletes []*Change
+	)
+	for _, o := range objs {
+		d, ok := kinds[o.Kind]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown kind %q, must be one of %s", o.Source, o.Kind, strings.Join(kindNames(kinds), ", "))
+		}
+		if err := d.check(o); err != nil {
+			return nil, err
+		}
+		if _, ok := byKind[o.Kind]; !ok {
+			order = append(order, o.Kind)
+		}
+		byKind[o.Kind] = append(byKind[o.Kind], o)
+	}
+
+	for _, kind := range order {
+		d := kinds[kind]
+		existing, err := d.listAll()
+		if err != nil {
+			return nil, err
+		}
+
+		matched := map[string]bool{}
+		seen := map[string]string{}
+		for _, o := range byKind[kind] {
+			key := d.key(o.Fields)
+			if src, ok := seen[key]; ok {
+				return nil, fmt.Errorf("%s: %s %s is already declared in %s", o.Source, kind, key, src)
+			}
+			seen[key] = o.Source
+
+			obj, err := d.match(o, existing)
+			if err != nil {
+				return nil, err
+			}
+			if obj == nil {
+				changes = append(changes, &Change{Action: Create, Def: d, Name: d.key(o.Fields), Fields: o.Fields, Source: o.Source})
+				continue
+			}
+
+			id := d.ID(obj)
+			matched[id] = true
+			c, err := d.diff(o, id, obj.(map[string]interface{}))
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, c)
+		}
+
+		if !prune {
+			continue
+		}
+		for _, obj := range existing {
+			if id := d.ID(obj); !matched[id] {
+				name, _ := obj.(map[string]interface{})[nameField].(string)
+				deletes = append(deletes, &Change{Action: Delete, Def: d, ID: id, Name: name})
+			}
+		}
+	}
+
+	// delete last, in reverse so the dependents go first
+	for i := len(deletes) - 1; i >= 0; i-- {
+		changes = append(changes, deletes[i])
+	}
+	return changes, nil
+}
+
+// Apply make the changes in order, and count the ones done. It stops at
+// the first failure, the summary tells what was changed until then
+func Apply(changes []*Change, done func(*Change)) (Summary, error) {
+	s := Summary{}
+	for _, c := range changes {
+		var err error
+		switch c.Action {
+		case Create:
+			var obj interface{}
+			obj, err = c.Def.do(http.MethodPost, "", nil, c.Def.Wrap(c.Fields), http.StatusCreated, c.Def.Singular)
+			c.ID = c.Def.ID(obj)
+		case Update:
+			_, err = c.Def.do(http.MethodPut, c.ID, nil, c.Def.Wrap(c.Fields), http.StatusOK, c.Def.Singular)
+		case Delete:
+			_, err = c.Def.do(http.MethodDelete, c.ID, nil, nil, http.StatusNoContent, "")
+		}
+		if err != nil {
+			return s, fmt.Errorf("%s %s %s: %w", c.Action, c.Def.Name, c.Name, err)
+		}
+
+		s[c.Action]++
+		if done != nil {
+			done(c)
+		}
+	}
+	return s, nil
+}
+
+// Count count the planned changes by action
+func Count(changes []*Change) Summary {
+	s := Summary{}
+	for _, c := range changes {
+		s[c.Action]++
+	}
+	return s
+}
+
+func kindNames(kinds map[string]*Definition) []string {
+	names := make([]string, 0, len(kinds))
+	for k := range kinds {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// check the object has only known fields of the right types, and the
+// required ones
+func (d *Definition) check(o Object) error {
+	if d.key(o.Fields) == "" {
+		return fmt.Errorf("%s: %s needs a %s or %s", o.Source, d.Name, nameField, d.idField())
+	}
+
+	for k, v := range o.Fields {
+		if k == d.idField() {
+			continue
+		}
+		f, ok := d.field(k)
+		if !ok {
+			return fmt.Errorf("%s: unknown %s field %q", o.Source, d.Name, k)
+		}
+		if !f.valid(v) {
+			return fmt.Errorf("%s: %s must be a %s", o.Source, k, f.Type)
+		}
+	}
+	for _, f := range d.Fields {
+		if _, ok := o.Fields[f.Name]; f.Required && !ok {
+			return fmt.Errorf("%s: %s is required", o.Source, f.Name)
+		}
+	}
+	return nil
+}
+
+func (d *Definition) field(name string) (Field, bool) {
+	for _, f := range d.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+func (f Field) valid(v interface{}) bool {
+	switch f.Type {
+	case Int:
+		_, ok := v.(int)
+		return ok
+	case Bool:
+		_, ok := v.(bool)
+		return ok
+	case List:
+		_, ok := v.([]interface{})
+		return ok
+	}
+	_, ok := v.(string)
+	return ok
+}
+
+// key the id of the object if given, its name otherwise
+func (d *Definition) key(fields map[string]interface{}) string {
+	for _, k := range []string{d.idField(), nameField} {
+		if v, ok := fields[k]; ok && v != nil {
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
+
+// match find the server resource of the manifest object, by id if given,
+// by name otherwise
+func (d *Definition) match(o Object, existing []interface{}) (interface{}, error) {
+	id, byID := o.Fields[d.idField()]
+
+	var found []interface{}
+	for _, obj := range existing {
+		m, _ := obj.(map[string]interface{})
+		if byID && d.ID(obj) == fmt.Sprint(id) ||
+			!byID && m[nameField] == o.Fields[nameField] {
+			found = append(found, obj)
+		}
+	}
+
+	switch {
+	case len(found) > 1:
+		return nil, fmt.Errorf("%s: %d %s are named %v, set the id to choose one", o.Source, len(found), d.Plural, o.Fields[nameField])
+	case len(found) == 0 && byID:
+		return nil, fmt.Errorf("%s: %s %v not found", o.Source, d.Name, id)
+	case len(found) == 0:
+		return nil, nil
+	}
+	return found[0], nil
+}
+
+// diff the manifest object against the server resource
+func (d *Definition) diff(o Object, id string, obj map[string]interface{}) (*Change, error) {
+	c := &Change{Action: Unchanged, Def: d, ID: id, Source: o.Source, Fields: map[string]interface{}{}}
+	c.Name, _ = obj[nameField].(string)
+
+	for _, f := range d.Fields {
+		want, ok := o.Fields[f.Name]
+		if !ok || jsonEqual(want, obj[f.Name]) {
+			continue
+		}
+		if !f.Updatable {
+			return nil, fmt.Errorf("%s: %s of %s %s can not be updated, delete and recreate it", o.Source, f.Name, d.Name, id)
+		}
+		c.Fields[f.Name] = want
+		c.Diffs = append(c.Diffs, fmt.Sprintf("%s: %s -> %s", f.Name, jsonString(obj[f.Name]), jsonString(want)))
+	}
+
+	if len(c.Diffs) != 0 {
+		c.Action = Update
+	}
+	return c, nil
+}
+
+// listAll list all the resources, page by page
+func (d *Definition) listAll() ([]interface{}, error) {
+	client, err := common.GlobalFlag.GetSDAClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var all []interface{}
+	pager := &common.Pager{Client: client, URL: d.URL(client.URL), Key: d.Plural, IDField: d.idField(), All: true}
+	err = pager.EachPage(common.GlobalFlag.Context(), func(page *common.Page) error {
+		all = append(all, page.Items...)
+		return nil
+	})
+	return all, err
+}
+
+// jsonEqual compare the values as json, so 1 from yaml equals 1 from the api
+func jsonEqual(a, b interface{}) bool {
+	return jsonString(a) == jsonString(b)
+}
+
+func jsonString(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,301 @@
+package resource
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"golang/app-cli/cmd/common"
+)
+
+// DefaultParallel how many bulk operations run at a time by default
+const DefaultParallel = 4
+
+// Stdin the ids are read from when the only argument is -
+var Stdin io.Reader = os.Stdin
+
+// the results of a bulk operation, besides the verb of the done ones
+const (
+	resultFailed  = "failed"
+	resultSkipped = "skipped"
+)
+
+// errSkipped the operation was not run, a previous one failed
+var errSkipped = errors.New("not run, a previous operation failed")
+
+// Result the outcome of the operation on one resource
+type Result struct {
+	ID  string
+	Obj interface{}
+	Err error
+}
+
+// Bulk run an operation on many resources, Parallel at most at a time
+type Bulk struct {
+	Parallel int
+	// ContinueOnError run the remaining operations after one failed,
+	// they're skipped otherwise, the ones already running still finish
+	ContinueOnError bool
+	// Done is called after each operation, by one goroutine at a time
+	Done func(done, failed, total int)
+}
+
+// Run run op on every id, the results are in the order of ids
+func (b *Bulk) Run(ids []string, op func(id string) (interface{}, error)) []Result {
+	parallel := b.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	var (
+		results = make([]Result, len(ids))
+		wg      sync.WaitGroup
+
+		mu                 sync.Mutex
+		next, done, failed int
+		stop               bool
+	)
+	for w := 0; w < parallel && w < len(ids); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				if next == len(ids) {
+					mu.Unlock()
+					return
+				}
+				i := next
+				next++
+				if stop {
+					results[i] = Result{ID: ids[i], Err: errSkipped}
+					mu.Unlock()
+					continue
+				}
+				mu.Unlock()
+
+				obj, err := op(ids[i])
+
+				mu.Lock()
+				results[i] = Result{ID: ids[i], Obj: obj, Err: err}
+				done++
+				if err != nil {
+					failed++
+					stop = stop || !b.ContinueOnError
+				}
+				if b.Done != nil {
+					b.Done(done, failed, len(ids))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+// BulkError some of the bulk operations failed
+type BulkError struct {
+	Verb    string
+	Failed  int
+	Skipped int
+	Total   int
+	code    int
+}
+
+func (e *BulkError) Error() string {
+	msg := fmt.Sprintf("%d of %d failed to be %s", e.Failed, e.Total, e.Verb)
+	if e.Skipped > 0 {
+		msg += fmt.Sprintf(", %d skipped", e.Skipped)
+	}
+	return msg
+}
+
+// ExitCode the exit code of the failures if they all agree, common.ExitError otherwise
+func (e *BulkError) ExitCode() int {
+	return e.code
+}
+
+// bulkError return a *BulkError if any of the results failed
+func bulkError(verb string, results []Result) error {
+	e := &BulkError{Verb: verb, Total: len(results)}
+	for _, r := range results {
+		switch {
+		case r.Err == errSkipped:
+			e.Skipped++
+		case r.Err != nil:
+			e.Failed++
+			if code := common.ExitCode(r.Err); e.code == 0 {
+				e.code = code
+			} else if e.code != code {
+				e.code = common.ExitError
+			}
+		}
+	}
+	if e.Failed == 0 {
+		return nil
+	}
+	return e
+}
+
+// addBulkFlags add --selector, --parallel and --continue-on-error
+func (d *Definition) addBulkFlags(cmd *cobra.Command) (*string, *int, *bool) {
+	return cmd.Flags().StringP("selector", "l", "", fmt.Sprintf("the %s matching all the field=value or field!=value, comma separated, eg: status=ERROR", d.Plural)),
+		cmd.Flags().Int("parallel", DefaultParallel, "how many to run at a time"),
+		cmd.Flags().Bool("continue-on-error", false, "go on with the others when one fails, they're skipped otherwise")
+}
+
+// bulkIDs the ids given by args, by - to read them from stdin, or by the selector
+func (d *Definition) bulkIDs(args []string, selector string) ([]string, error) {
+	if selector != "" {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("give either the %s ids or --selector, not both", d.Name)
+		}
+		return d.selectIDs(selector)
+	}
+
+	if len(args) == 1 && args[0] == "-" {
+		var err error
+		if args, err = readIDs(Stdin); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		ids  []string
+		seen = map[string]bool{}
+	)
+	for _, id := range args {
+		if id == "-" {
+			return nil, fmt.Errorf("- must be the only argument, to read the ids from stdin")
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// readIDs read the ids separated by spaces or lines, # starts a comment
+func readIDs(r io.Reader) ([]string, error) {
+	var ids []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		ids = append(ids, strings.Fields(line)...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read the ids from stdin: %s", err)
+	}
+	return ids, nil
+}
+
+// selectIDs list all the resources and return the ids of the matching ones
+func (d *Definition) selectIDs(selector string) ([]string, error) {
+	type term struct {
+		field, value string
+		not          bool
+	}
+	var terms []term
+	for _, s := range strings.Split(selector, ",") {
+		t := term{}
+		i := strings.Index(s, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid selector %q, want field=value or field!=value", s)
+		}
+		t.field, t.value = strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])
+		if strings.HasSuffix(t.field, "!") {
+			t.field, t.not = strings.TrimSpace(strings.TrimSuffix(t.field, "!")), true
+		}
+		terms = append(terms, t)
+	}
+
+	objs, err := d.listAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, obj := range objs {
+		m, _ := obj.(map[string]interface{})
+		match := true
+		for _, t := range terms {
+			v, ok := m[t.field]
+			if (ok && v != nil && fmt.Sprint(v) == t.value) == t.not {
+				match = false
+				break
+			}
+		}
+		if match {
+			ids = append(ids, d.ID(obj))
+		}
+	}
+	return ids, nil
+}
+
+// runBulk run op on the ids, with a progress line on a terminal, print
+// the result of each and the summary
+func (d *Definition) runBulk(cmd *cobra.Command, verb string, ids []string, parallel int, continueOnError bool,
+	op func(id string) (interface{}, error)) error {
+	if len(ids) == 0 {
+		fmt.Fprintf(cmd.OutOrStderr(), "no %s to be %s\n", d.Plural, verb)
+		return nil
+	}
+
+	stderr := cmd.OutOrStderr()
+	live := isTerminal(stderr)
+	b := &Bulk{
+		Parallel:        parallel,
+		ContinueOnError: continueOnError,
+		Done: func(done, failed, total int) {
+			if live {
+				fmt.Fprintf(stderr, "\r%s: %d/%d %s, %d failed", d.Name, done-failed, total, verb, failed)
+			}
+		},
+	}
+	results := b.Run(ids, op)
+	if live {
+		// clear the progress line
+		fmt.Fprint(stderr, "\r\033[K")
+	}
+
+	summary := map[string]int{}
+	rows := make([]interface{}, 0, len(results))
+	for _, r := range results {
+		row := map[string]interface{}{"id": r.ID, "result": verb, "error": ""}
+		switch {
+		case r.Err == errSkipped:
+			row["result"] = resultSkipped
+		case r.Err != nil:
+			row["result"], row["error"] = resultFailed, r.Err.Error()
+		}
+		summary[row["result"].(string)]++
+		rows = append(rows, row)
+	}
+	if err := common.GlobalFlag.PrintObj(rows, []string{"id", "result", "error"}); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stderr, "%d %s, %d failed, %d skipped\n", summary[verb], verb, summary[resultFailed], summary[resultSkipped])
+	return bulkError(verb, results)
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
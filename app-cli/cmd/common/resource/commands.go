@@ -0,0 +1,395 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"golang/app-cli/cmd/common"
+)
+
+// Command generate the resource command, with the create, list,
+// get, update and delete subcommands
+func (d *Definition) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   d.Name,
+		Short: d.Short,
+	}
+
+	cmd.AddCommand(
+		d.createCommand(),
+		d.listCommand(),
+		d.getCommand(),
+		d.updateCommand(),
+		d.deleteCommand(),
+	)
+
+	return cmd
+}
+
+func flagName(field string) string {
+	return strings.Replace(field, "_", "-", -1)
+}
+
+// addFieldFlags add a flag for every field, only the updatable ones for update
+func (d *Definition) addFieldFlags(flags *pflag.FlagSet, update bool) {
+	for _, f := range d.Fields {
+		if update && !f.Updatable {
+			continue
+		}
+
+		help := f.Help
+		if f.Required && !update {
+			help += " (required)"
+		}
+
+		switch f.Type {
+		case Int:
+			flags.Int(flagName(f.Name), 0, help)
+		case Bool:
+			flags.Bool(flagName(f.Name), false, help)
+		case List:
+			flags.StringSlice(flagName(f.Name), nil, help)
+		default:
+			flags.String(flagName(f.Name), "", help)
+		}
+	}
+}
+
+// fieldValues collect the fields whose flags are set
+func (d *Definition) fieldValues(flags *pflag.FlagSet, update bool) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+
+	for _, f := range d.Fields {
+		if update && !f.Updatable {
+			continue
+		}
+
+		name := flagName(f.Name)
+		if !flags.Changed(name) {
+			if f.Required && !update {
+				return nil, fmt.Errorf("--%s is required", name)
+			}
+			continue
+		}
+
+		var (
+			v   interface{}
+			err error
+		)
+		switch f.Type {
+		case Int:
+			v, err = flags.GetInt(name)
+		case Bool:
+			v, err = flags.GetBool(name)
+		case List:
+			v, err = flags.GetStringSlice(name)
+		default:
+			v, err = flags.GetString(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[f.Name] = v
+	}
+
+	return values, nil
+}
+
+// do send the request to the service and decode the object under key,
+// an empty key means no body is expected
+func (d *Definition) do(method, path string, query url.Values, body interface{}, okStatus int, key string) (interface{}, error) {
+	client, err := common.GlobalFlag.GetSDAClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var elem []string
+	if path != "" {
+		elem = append(elem, path)
+	}
+	u := d.URL(client.URL, elem...)
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	r := common.Request{
+		URL:          u,
+		Method:       method,
+		OkStatusCode: okStatus,
+	}
+	if method != http.MethodGet {
+		// accepted, the resource moves on asynchronously
+		r.OkStatusCodes = []int{http.StatusAccepted}
+	}
+	if body != nil {
+		if r.Body, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := client.DoRequest(common.GlobalFlag.Context(), r)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return nil, nil
+	}
+
+	return Unwrap(resp.Body, key)
+}
+
+func (d *Definition) createCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: fmt.Sprintf("create a %s", d.Name),
+	}
+	d.addFieldFlags(cmd.Flags(), false)
+	wait, timeout := addWaitFlags(cmd, "wait", fmt.Sprintf("wait until the %s is ready", d.Name))
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		values, err := d.fieldValues(cmd.Flags(), false)
+		if err != nil {
+			return err
+		}
+
+		obj, err := d.do(http.MethodPost, "", nil, d.Wrap(values), http.StatusCreated, d.Singular)
+		if err != nil {
+			return err
+		}
+		if *wait {
+			if obj, err = d.wait(cmd, d.ID(obj), false, *timeout); err != nil {
+				return err
+			}
+		}
+
+		return common.GlobalFlag.PrintObj(obj, d.Columns)
+	}
+
+	return cmd
+}
+
+func (d *Definition) listCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: fmt.Sprintf("list %s", d.Plural),
+	}
+	for _, f := range d.Filters {
+		cmd.Flags().String(flagName(f.Name), "", f.Help)
+	}
+	limit := cmd.Flags().Int("limit", 0, "list at most this many, following the pages if needed")
+	marker := cmd.Flags().String("marker", "", fmt.Sprintf("list the %s after the one of this id", d.Plural))
+	all := cmd.Flags().Bool("all", false, "follow the pages until the last one, only the first page is listed otherwise")
+	pageSize := cmd.Flags().Int("page-size", 0, "how many to ask for per request, the api default if not set")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if *limit < 0 || *pageSize < 0 {
+			return fmt.Errorf("--limit and --page-size must not be negative")
+		}
+		if *all && *limit > 0 {
+			return fmt.Errorf("--all and --limit can not be used together")
+		}
+
+		query := url.Values{}
+		for _, f := range d.Filters {
+			if v, _ := cmd.Flags().GetString(flagName(f.Name)); v != "" {
+				query.Set(f.Name, v)
+			}
+		}
+
+		client, err := common.GlobalFlag.GetSDAClient()
+		if err != nil {
+			return err
+		}
+		u := d.URL(client.URL)
+		if len(query) > 0 {
+			u += "?" + query.Encode()
+		}
+
+		pager := &common.Pager{
+			Client:   client,
+			URL:      u,
+			Key:      d.Plural,
+			IDField:  d.idField(),
+			PageSize: *pageSize,
+			Limit:    *limit,
+			Marker:   *marker,
+			All:      *all,
+		}
+		if err := common.GlobalFlag.PrintPages(pager, d.Columns); err != nil {
+			return err
+		}
+
+		if pager.More && *limit == 0 {
+			fmt.Fprintf(cmd.OutOrStderr(), "there are more %s, list them by --all or --marker %s\n", d.Plural, pager.Last)
+		}
+		return nil
+	}
+
+	return cmd
+}
+
+func (d *Definition) getCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get <id>",
+		Short: fmt.Sprintf("get a %s", d.Name),
+	}
+	watch, timeout := addWaitFlags(cmd, "watch", fmt.Sprintf("print the %s each time it changes, until it's ready or gone", d.Name))
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("get needs exactly one %s id", d.Name)
+		}
+		if *watch {
+			return d.watch(args[0], *timeout)
+		}
+
+		obj, err := d.do(http.MethodGet, args[0], nil, nil, http.StatusOK, d.Singular)
+		if err != nil {
+			return err
+		}
+
+		return common.GlobalFlag.PrintObj(obj, d.Columns)
+	}
+
+	return cmd
+}
+
+func (d *Definition) updateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "update <id>... | -",
+		Short: fmt.Sprintf("update %s, the ids are read from stdin with -", d.Plural),
+		Long: fmt.Sprintf(`Update a %s and print it, or many at once, given by the ids, by - to read
+them from stdin or by --selector, and print the result of each.`, d.Name),
+	}
+	d.addFieldFlags(cmd.Flags(), true)
+	wait, timeout := addWaitFlags(cmd, "wait", fmt.Sprintf("wait until the %s is ready", d.Name))
+	selector, parallel, continueOnError := d.addBulkFlags(cmd)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && *selector == "" {
+			return fmt.Errorf("update needs the %s ids, - or --selector", d.Name)
+		}
+
+		values, err := d.fieldValues(cmd.Flags(), true)
+		if err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			return fmt.Errorf("nothing to update, set at least one field")
+		}
+
+		update := func(id string) (interface{}, error) {
+			obj, err := d.do(http.MethodPut, id, nil, d.Wrap(values), http.StatusOK, d.Singular)
+			if err != nil || !*wait {
+				return obj, err
+			}
+			return d.wait(cmd, id, false, *timeout)
+		}
+
+		if len(args) == 1 && args[0] != "-" && *selector == "" {
+			obj, err := update(args[0])
+			if err != nil {
+				return err
+			}
+			return common.GlobalFlag.PrintObj(obj, d.Columns)
+		}
+
+		ids, err := d.bulkIDs(args, *selector)
+		if err != nil {
+			return err
+		}
+		return d.runBulk(cmd, "updated", ids, *parallel, *continueOnError, update)
+	}
+
+	return cmd
+}
+
+func (d *Definition) deleteCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete <id>... | -",
+		Short: fmt.Sprintf("delete %s, the ids are read from stdin with -", d.Plural),
+		Long: fmt.Sprintf(`Delete a %s, or many at once, given by the ids, by - to read them from
+stdin or by --selector, and print the result of each.`, d.Name),
+	}
+	wait, timeout := addWaitFlags(cmd, "wait", fmt.Sprintf("wait until the %s is gone", d.Name))
+	selector, parallel, continueOnError := d.addBulkFlags(cmd)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && *selector == "" {
+			return fmt.Errorf("delete needs the %s ids, - or --selector", d.Name)
+		}
+
+		del := func(id string) (interface{}, error) {
+			if _, err := d.do(http.MethodDelete, id, nil, nil, http.StatusNoContent, ""); err != nil || !*wait {
+				return nil, err
+			}
+			return d.wait(cmd, id, true, *timeout)
+		}
+
+		if len(args) == 1 && args[0] != "-" && *selector == "" {
+			if _, err := del(args[0]); err != nil {
+				return err
+			}
+			fmt.Fprintf(common.GlobalFlag.Out(), "%s %s deleted\n", d.Name, args[0])
+			return nil
+		}
+
+		ids, err := d.bulkIDs(args, *selector)
+		if err != nil {
+			return err
+		}
+		return d.runBulk(cmd, "deleted", ids, *parallel, *continueOnError, del)
+	}
+
+	return cmd
+}
+
+// addWaitFlags add the --wait or --watch flag, and --wait-timeout
+func addWaitFlags(cmd *cobra.Command, name, help string) (*bool, *time.Duration) {
+	return cmd.Flags().Bool(name, false, help),
+		cmd.Flags().Duration("wait-timeout", DefaultWaitTimeout, fmt.Sprintf("give up --%s after this duration", name))
+}
+
+// wait poll the resource until it's ready or gone, the status changes
+// are printed to stderr as they happen
+func (d *Definition) wait(cmd *cobra.Command, id string, deleted bool, timeout time.Duration) (interface{}, error) {
+	w := &Waiter{
+		Def:     d,
+		ID:      id,
+		Deleted: deleted,
+		Timeout: timeout,
+		Changed: d.statusPrinter(id, cmd.OutOrStderr()),
+	}
+	return w.Wait()
+}
+
+// watch print the resource each time it changes, until it's ready or gone
+func (d *Definition) watch(id string, timeout time.Duration) error {
+	p, err := common.GlobalFlag.Printer(d.Columns)
+	if err != nil {
+		return err
+	}
+
+	w := &Waiter{
+		Def:     d,
+		ID:      id,
+		Watch:   true,
+		Timeout: timeout,
+		Changed: func(obj interface{}) error {
+			if obj == nil {
+				_, err := fmt.Fprintf(common.GlobalFlag.Out(), "%s %s deleted\n", d.Name, id)
+				return err
+			}
+			return p.PrintObj(obj, common.GlobalFlag.Out())
+		},
+	}
+	_, err = w.Wait()
+	return err
+}
@@ -0,0 +1,138 @@
+package resource
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ManifestExts the file extensions read from a manifest directory
+var ManifestExts = []string{".yaml", ".yml", ".json"}
+
+// Object a resource declared in a manifest, eg:
+//
+//	kind: resourceA
+//	name: web
+//	description: the front
+type Object struct {
+	Kind   string
+	Fields map[string]interface{}
+	// Source the file and document number it's read from
+	Source string
+}
+
+// ReadManifests read the objects of the manifest files, a directory is
+// read file by file in name order, and "-" reads stdin
+func ReadManifests(path string, stdin io.Reader) ([]Object, error) {
+	if path == "-" {
+		return decodeManifest("<stdin>", stdin)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return readManifest(path)
+	}
+
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() && isManifest(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var objs []Object
+	for _, name := range names {
+		o, err := readManifest(filepath.Join(path, name))
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, o...)
+	}
+	return objs, nil
+}
+
+func isManifest(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range ManifestExts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+func readManifest(path string) ([]Object, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return decodeManifest(path, f)
+}
+
+// decodeManifest decode the yaml documents, json is read as yaml
+func decodeManifest(source string, r io.Reader) ([]Object, error) {
+	var objs []Object
+
+	d := yaml.NewDecoder(r)
+	for i := 1; ; i++ {
+		var doc interface{}
+		err := d.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", source, err)
+		}
+		if doc == nil {
+			// an empty document, eg: a trailing "---"
+			continue
+		}
+
+		src := fmt.Sprintf("%s#%d", source, i)
+		m, ok := toJSON(doc).(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: a document must be an object", src)
+		}
+		kind, _ := m["kind"].(string)
+		if kind == "" {
+			return nil, fmt.Errorf("%s: missing kind", src)
+		}
+		delete(m, "kind")
+
+		objs = append(objs, Object{Kind: kind, Fields: m, Source: src})
+	}
+
+	return objs, nil
+}
+
+// toJSON convert the yaml maps to the map[string]interface{} of json
+func toJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = toJSON(e)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = toJSON(v[i])
+		}
+	}
+	return v
+}
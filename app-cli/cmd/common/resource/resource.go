@@ -0,0 +1,158 @@
+package resource
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang/app-cli/cmd/common/printer"
+)
+
+// the field types
+const (
+	String = "string"
+	Int    = "int"
+	Bool   = "bool"
+	List   = "list"
+)
+
+// Field a field set by the create and update commands, the flag
+// name is the json name with "_" replaced by "-"
+type Field struct {
+	Name      string
+	Type      string
+	Help      string
+	Required  bool
+	Updatable bool
+}
+
+// Filter a list filter, sent as a query parameter
+type Filter struct {
+	Name string
+	Help string
+}
+
+// Definition describe a resource of the service, the CRUD commands
+// are generated from it
+type Definition struct {
+	// Name the command name, eg: resourceA
+	Name  string
+	Short string
+
+	// Path the collection path, eg: resourceAs
+	Path string
+	// Singular and Plural the json keys wrapping a resource and a list
+	Singular string
+	Plural   string
+	// IDField the field identifying a resource, "id" if not set
+	IDField string
+
+	Filters []Filter
+	Fields  []Field
+	// Columns the default table columns
+	Columns []string
+
+	// StatusField the field of the status waited for, "status" if not set
+	StatusField string
+	// ReadyStatus the status the operations end in, DefaultReadyStatus if not set
+	ReadyStatus []string
+	// FailedStatus the status of a failed operation, DefaultFailedStatus if not set
+	FailedStatus []string
+}
+
+// the status waited for when the definition sets none
+var (
+	DefaultReadyStatus  = []string{"ACTIVE", "AVAILABLE"}
+	DefaultFailedStatus = []string{"ERROR", "FAILED"}
+)
+
+func (d *Definition) idField() string {
+	if d.IDField == "" {
+		return "id"
+	}
+	return d.IDField
+}
+
+func (d *Definition) statusField() string {
+	if d.StatusField == "" {
+		return "status"
+	}
+	return d.StatusField
+}
+
+// Status return the status of the decoded resource
+func (d *Definition) Status(obj interface{}) string {
+	if m, ok := obj.(map[string]interface{}); ok && m[d.statusField()] != nil {
+		return fmt.Sprint(m[d.statusField()])
+	}
+	return ""
+}
+
+// Ready the status is one the operations end in
+func (d *Definition) Ready(status string) bool {
+	ready := d.ReadyStatus
+	if ready == nil {
+		ready = DefaultReadyStatus
+	}
+	return hasStatus(ready, status)
+}
+
+// Failed the status is one of a failed operation
+func (d *Definition) Failed(status string) bool {
+	failed := d.FailedStatus
+	if failed == nil {
+		failed = DefaultFailedStatus
+	}
+	return hasStatus(failed, status)
+}
+
+func hasStatus(list []string, status string) bool {
+	for _, s := range list {
+		if strings.EqualFold(s, status) {
+			return true
+		}
+	}
+	return false
+}
+
+// URL join the service endpoint, the resource path and elem
+func (d *Definition) URL(endpoint string, elem ...string) string {
+	for i := range elem {
+		elem[i] = url.PathEscape(elem[i])
+	}
+	return strings.Join(append([]string{strings.TrimSuffix(endpoint, "/"), d.Path}, elem...), "/")
+}
+
+// ID return the id of the decoded resource
+func (d *Definition) ID(obj interface{}) string {
+	if m, ok := obj.(map[string]interface{}); ok {
+		if id, ok := m[d.idField()]; ok {
+			return fmt.Sprint(id)
+		}
+	}
+	return ""
+}
+
+// Wrap wrap the resource body under the singular key
+func (d *Definition) Wrap(obj interface{}) map[string]interface{} {
+	return map[string]interface{}{d.Singular: obj}
+}
+
+// Unwrap decode the response body and return the object under key
+func Unwrap(body []byte, key string) (interface{}, error) {
+	obj, err := printer.Decode(body)
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := obj.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid response body, want an object with %q", key)
+	}
+	v, ok := m[key]
+	if !ok {
+		return nil, fmt.Errorf("invalid response body, missing %q", key)
+	}
+
+	return v, nil
+}
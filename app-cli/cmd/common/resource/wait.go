@@ -0,0 +1,177 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"time"
+
+	"golang/app-cli/cmd/common"
+)
+
+// the polling interval grows from PollInterval to MaxPollInterval
+var (
+	PollInterval    = time.Second
+	MaxPollInterval = 15 * time.Second
+)
+
+// DefaultWaitTimeout how long --wait and --watch poll by default
+const DefaultWaitTimeout = 10 * time.Minute
+
+// FailedError the resource went into a failure status
+type FailedError struct {
+	Name   string
+	ID     string
+	Status string
+}
+
+func (e *FailedError) Error() string {
+	return fmt.Sprintf("%s %s is %s", e.Name, e.ID, e.Status)
+}
+
+// ExitCode exit with common.ExitResourceFailed
+func (e *FailedError) ExitCode() int {
+	return common.ExitResourceFailed
+}
+
+// WaitTimeoutError the resource did not reach the status in time
+type WaitTimeoutError struct {
+	Name    string
+	ID      string
+	Status  string
+	Timeout time.Duration
+}
+
+func (e *WaitTimeoutError) Error() string {
+	return fmt.Sprintf("%s %s still %s after %s", e.Name, e.ID, e.Status, e.Timeout)
+}
+
+// ExitCode exit with common.ExitTimeout
+func (e *WaitTimeoutError) ExitCode() int {
+	return common.ExitTimeout
+}
+
+// Waiter poll a resource until it's ready, or gone when Deleted is set.
+// Watch stops at either
+type Waiter struct {
+	Def     *Definition
+	ID      string
+	Deleted bool
+	Watch   bool
+	Timeout time.Duration
+
+	// Changed is called with the resource each time it changes, and
+	// with nil when it's gone
+	Changed func(obj interface{}) error
+}
+
+// Wait poll the resource with backoff, and return it once it's ready,
+// nil once it's gone. A failure status stops it with a *FailedError
+func (w *Waiter) Wait() (interface{}, error) {
+	ctx := common.GlobalFlag.Context()
+	if w.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.Timeout)
+		defer cancel()
+	}
+
+	var (
+		last     interface{}
+		status   string
+		interval = PollInterval
+	)
+	for {
+		obj, gone, err := w.get(ctx)
+		if err != nil {
+			return nil, w.timeout(ctx, status, err)
+		}
+
+		if gone {
+			if w.Changed != nil && last != nil {
+				if err := w.Changed(nil); err != nil {
+					return nil, err
+				}
+			}
+			if w.Deleted || w.Watch {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("%s %s is gone", w.Def.Name, w.ID)
+		}
+
+		if !reflect.DeepEqual(obj, last) && w.Changed != nil {
+			if err := w.Changed(obj); err != nil {
+				return nil, err
+			}
+		}
+		last = obj
+		status = w.Def.Status(obj)
+
+		if w.Def.Failed(status) {
+			return obj, &FailedError{Name: w.Def.Name, ID: w.ID, Status: status}
+		}
+		if !w.Deleted && w.Def.Ready(status) {
+			return obj, nil
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil, w.timeout(ctx, status, ctx.Err())
+		}
+		if interval = interval * 3 / 2; interval > MaxPollInterval {
+			interval = MaxPollInterval
+		}
+	}
+}
+
+// get the resource, gone is set if it's not found
+func (w *Waiter) get(ctx context.Context) (interface{}, bool, error) {
+	client, err := common.GlobalFlag.GetSDAClient()
+	if err != nil {
+		return nil, false, err
+	}
+
+	resp, err := client.DoRequest(ctx, common.Request{
+		URL:           w.Def.URL(client.URL, w.ID),
+		Method:        http.MethodGet,
+		OkStatusCode:  http.StatusOK,
+		OkStatusCodes: []int{http.StatusNotFound},
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, true, nil
+	}
+
+	obj, err := Unwrap(resp.Body, w.Def.Singular)
+	return obj, false, err
+}
+
+// timeout turn the error into a *WaitTimeoutError if it's the wait
+// timeout, not the --timeout of the whole command, that expired
+func (w *Waiter) timeout(ctx context.Context, status string, err error) error {
+	if ctx.Err() == context.DeadlineExceeded && common.GlobalFlag.Context().Err() == nil {
+		return &WaitTimeoutError{Name: w.Def.Name, ID: w.ID, Status: status, Timeout: w.Timeout}
+	}
+	return err
+}
+
+// statusPrinter print the status changes, eg: resourceA 1f2e: BUILD
+func (d *Definition) statusPrinter(id string, out io.Writer) func(obj interface{}) error {
+	var last string
+	return func(obj interface{}) error {
+		status := "deleted"
+		if obj != nil {
+			status = d.Status(obj)
+		}
+		if status == last {
+			return nil
+		}
+		last = status
+		_, err := fmt.Fprintf(out, "%s %s: %s\n", d.Name, id, status)
+		return err
+	}
+}
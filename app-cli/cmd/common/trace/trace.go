@@ -0,0 +1,190 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Redacted replace the secrets in the logs
+const Redacted = "***"
+
+// secretHeaders the headers carrying tokens, and the env var the curl
+// command reads each from
+var secretHeaders = map[string]string{
+	"X-Auth-Token":    "OS_TOKEN",
+	"X-Subject-Token": "SUBJECT_TOKEN",
+}
+
+// secretFields the json fields carrying passwords and secrets
+var secretFields = map[string]bool{
+	"password": true,
+	"secret":   true,
+}
+
+// Transport log every request and response, and the curl command
+// reproducing the request, the tokens and passwords are redacted
+type Transport struct {
+	Base http.RoundTripper
+	Out  io.Writer
+}
+
+// NewTransport use to new a tracing transport over the default one
+func NewTransport(out io.Writer) *Transport {
+	return &Transport{Base: http.DefaultTransport, Out: out}
+}
+
+// RoundTrip log the request, send it by the base transport and log the response
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := ReadBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, ">>> %s %s\n", req.Method, req.URL)
+	writeHeaders(buf, ">>> ", req.Header)
+	if len(reqBody) > 0 {
+		fmt.Fprintf(buf, ">>>\n>>> %s\n", RedactBody(reqBody))
+	}
+	fmt.Fprintf(buf, "%s\n", Curl(req, reqBody))
+	t.Out.Write(buf.Bytes())
+
+	start := time.Now()
+	resp, err := t.Base.RoundTrip(req)
+	took := time.Since(start)
+	if err != nil {
+		fmt.Fprintf(t.Out, "<<< error after %s: %s\n\n", took, err)
+		return nil, err
+	}
+
+	respBody, err := ReadBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	buf.Reset()
+	fmt.Fprintf(buf, "<<< %s (%s)\n", resp.Status, took)
+	writeHeaders(buf, "<<< ", resp.Header)
+	if len(respBody) > 0 {
+		fmt.Fprintf(buf, "<<<\n<<< %s\n", RedactBody(respBody))
+	}
+	buf.WriteString("\n")
+	t.Out.Write(buf.Bytes())
+
+	return resp, nil
+}
+
+// ReadBody read the body and put back a new reader of it
+func ReadBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = ioutil.NopCloser(bytes.NewReader(data))
+
+	return data, nil
+}
+
+func writeHeaders(w io.Writer, prefix string, h http.Header) {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		for _, v := range h[k] {
+			fmt.Fprintf(w, "%s%s: %s\n", prefix, k, RedactHeader(k, v))
+		}
+	}
+}
+
+// RedactHeader hide the value of the token headers
+func RedactHeader(key, value string) string {
+	if _, ok := secretHeaders[http.CanonicalHeaderKey(key)]; ok {
+		return Redacted
+	}
+	return value
+}
+
+// RedactBody hide the passwords and secrets in a json body, and the
+// token id of a keystone v2.0 token, other bodies are returned as they are
+func RedactBody(body []byte) []byte {
+	var obj interface{}
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if err := d.Decode(&obj); err != nil {
+		return body
+	}
+
+	data, err := json.Marshal(redact(obj, ""))
+	if err != nil {
+		return body
+	}
+	return data
+}
+
+func redact(obj interface{}, parent string) interface{} {
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		for k, v := range o {
+			_, isString := v.(string)
+			if isString && (secretFields[k] || (parent == "token" && k == "id")) {
+				o[k] = Redacted
+				continue
+			}
+			o[k] = redact(v, k)
+		}
+	case []interface{}:
+		for i, v := range o {
+			o[i] = redact(v, parent)
+		}
+	}
+	return obj
+}
+
+// Curl the curl command reproducing the request, the tokens are read
+// from the env vars, OS_TOKEN for X-Auth-Token and SUBJECT_TOKEN for
+// X-Subject-Token
+func Curl(req *http.Request, body []byte) string {
+	parts := []string{"curl -g -i -X", req.Method, quote(req.URL.String())}
+
+	keys := make([]string, 0, len(req.Header))
+	for k := range req.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		for _, v := range req.Header[k] {
+			if env, ok := secretHeaders[http.CanonicalHeaderKey(k)]; ok {
+				parts = append(parts, "-H", fmt.Sprintf(`"%s: ${%s}"`, k, env))
+				continue
+			}
+			parts = append(parts, "-H", quote(k+": "+v))
+		}
+	}
+
+	if len(body) > 0 {
+		parts = append(parts, "-d", quote(string(RedactBody(body))))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// quote single quote s for the shell
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,101 @@
+package trace
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedactHeader(t *testing.T) {
+	for _, c := range []struct {
+		key, value, want string
+	}{
+		{"X-Auth-Token", "tok", Redacted},
+		{"x-auth-token", "tok", Redacted},
+		{"X-Subject-Token", "tok", Redacted},
+		{"Content-Type", "application/json", "application/json"},
+	} {
+		if got := RedactHeader(c.key, c.value); got != c.want {
+			t.Errorf("RedactHeader(%q) = %q, want %q", c.key, got, c.want)
+		}
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	for _, c := range []struct {
+		body, want string
+	}{
+		{`{"auth":{"identity":{"password":{"user":{"name":"alice","password":"s3cret"}}}}}`,
+			`{"auth":{"identity":{"password":{"user":{"name":"alice","password":"***"}}}}}`},
+		{`{"application_credential":{"id":"a1","secret":"s3cret"}}`,
+			`{"application_credential":{"id":"a1","secret":"***"}}`},
+		{`{"access":{"token":{"id":"s3cret","expires":"x"},"user":{"id":"u1"}}}`,
+			`{"access":{"token":{"expires":"x","id":"***"},"user":{"id":"u1"}}}`},
+		{`{"items":[{"password":"s3cret","size":1.5}]}`, `{"items":[{"password":"***","size":1.5}]}`},
+		{`not json, password=s3cret`, `not json, password=s3cret`},
+	} {
+		if got := string(RedactBody([]byte(c.body))); got != c.want {
+			t.Errorf("RedactBody(%s) = %s, want %s", c.body, got, c.want)
+		}
+	}
+}
+
+func TestCurl(t *testing.T) {
+	for _, c := range []struct {
+		header string
+		want   string
+	}{
+		{"X-Auth-Token", `-H "X-Auth-Token: ${OS_TOKEN}"`},
+		{"X-Subject-Token", `-H "X-Subject-Token: ${SUBJECT_TOKEN}"`},
+		{"X-Openstack-Request-Id", `-H 'X-Openstack-Request-Id: s3cret'`},
+	} {
+		req, _ := http.NewRequest("GET", "http://keystone/v3/auth/tokens", nil)
+		req.Header.Set(c.header, "s3cret")
+		if got := Curl(req, nil); !strings.Contains(got, c.want) {
+			t.Errorf("curl with %s: want %s, got %s", c.header, c.want, got)
+		}
+	}
+
+	req, _ := http.NewRequest("POST", "http://keystone/it's", nil)
+	got := Curl(req, []byte(`{"password":"s3cret"}`))
+	if want := `curl -g -i -X POST 'http://keystone/it'\''s' -d '{"password":"***"}'`; got != want {
+		t.Errorf("curl = %s, want %s", got, want)
+	}
+}
+
+// no secret of the request or the response is in the log
+func TestTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Subject-Token", "s3cret-subject")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"token":{"id":"s3cret-v2","expires_at":"x"}}`))
+	}))
+	defer srv.Close()
+
+	log := &bytes.Buffer{}
+	client := &http.Client{Transport: &Transport{Base: http.DefaultTransport, Out: log}}
+	req, _ := http.NewRequest("POST", srv.URL+"/v3/auth/tokens",
+		strings.NewReader(`{"auth":{"identity":{"password":{"user":{"password":"s3cret-password"}}}}}`))
+	req.Header.Set("X-Auth-Token", "s3cret-token")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if !strings.Contains(string(body), "s3cret-v2") {
+		t.Errorf("want the body untouched for the caller, got %s", body)
+	}
+	if strings.Contains(log.String(), "s3cret") {
+		t.Errorf("a secret is in the log:\n%s", log)
+	}
+	for _, want := range []string{">>> POST " + srv.URL, "<<< 201 Created", "X-Subject-Token: " + Redacted, "curl -g -i -X POST"} {
+		if !strings.Contains(log.String(), want) {
+			t.Errorf("log missing %q:\n%s", want, log)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// APIVersionHeader the header requesting a microversion, its value is
+// "<service type> <microversion>", eg: "sda 1.5"
+const APIVersionHeader = "OpenStack-API-Version"
+
+// LatestAPIVersion request the newest microversion the service supports
+const LatestAPIVersion = "latest"
+
+// apiVersion a "major.minor" version, Minor is -1 if only the major is set
+type apiVersion struct {
+	Major int
+	Minor int
+}
+
+// parseAPIVersion parse "1", "v1", "1.5" or "v1.5"
+func parseAPIVersion(s string) (apiVersion, error) {
+	parts := strings.SplitN(strings.TrimPrefix(strings.ToLower(s), "v"), ".", 2)
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil || major < 0 {
+		return apiVersion{}, fmt.Errorf("invalid api version %q, want like 1 or 1.5", s)
+	}
+	v := apiVersion{Major: major, Minor: -1}
+
+	if len(parts) == 2 {
+		if v.Minor, err = strconv.Atoi(parts[1]); err != nil || v.Minor < 0 {
+			return apiVersion{}, fmt.Errorf("invalid api version %q, want like 1 or 1.5", s)
+		}
+	}
+
+	return v, nil
+}
+
+func (v apiVersion) less(o apiVersion) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+	return v.Minor < o.Minor
+}
+
+func (v apiVersion) String() string {
+	if v.Minor < 0 {
+		return strconv.Itoa(v.Major)
+	}
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// describe the version and its microversion range, for the error messages
+func (v version) describe() string {
+	if v.MaxVersion == "" {
+		return fmt.Sprintf("%s (%s)", v.ID, v.Status)
+	}
+	return fmt.Sprintf("%s (%s, %s - %s)", v.ID, v.Status, v.MinVersion, v.MaxVersion)
+}
+
+// negotiateVersion choose the version of the versions document matching
+// the requested api version, and the microversion to request:
+//   - "" choose the CURRENT version, no microversion
+//   - "latest" choose the CURRENT version and its max microversion
+//   - "1" choose the version 1, no microversion
+//   - "1.5" choose the version 1 if it supports the microversion 1.5
+func negotiateVersion(serviceName string, versions []version, requested string) (version, string, error) {
+	var current *version
+	for i := range versions {
+		if versions[i].Status == "CURRENT" {
+			current = &versions[i]
+		}
+	}
+
+	if requested == "" || requested == LatestAPIVersion {
+		if current == nil {
+			return version{}, "", fmt.Errorf("no CURRENT api version found for %s", serviceName)
+		}
+		if requested == LatestAPIVersion {
+			return *current, current.MaxVersion, nil
+		}
+		return *current, "", nil
+	}
+
+	want, err := parseAPIVersion(requested)
+	if err != nil {
+		return version{}, "", err
+	}
+
+	var supported []string
+	for _, v := range versions {
+		supported = append(supported, v.describe())
+
+		id, err := parseAPIVersion(v.ID)
+		if err != nil || id.Major != want.Major {
+			continue
+		}
+
+		// only the major is requested, or the version has no microversions
+		if want.Minor < 0 {
+			return v, "", nil
+		}
+		if v.MaxVersion == "" {
+			if id.Minor == want.Minor || (id.Minor < 0 && want.Minor == 0) {
+				return v, "", nil
+			}
+			continue
+		}
+
+		min, err1 := parseAPIVersion(v.MinVersion)
+		max, err2 := parseAPIVersion(v.MaxVersion)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		if !want.less(min) && !max.less(want) {
+			return v, want.String(), nil
+		}
+	}
+
+	return version{}, "", fmt.Errorf("api version %s is not supported by %s, supported: %s",
+		requested, serviceName, strings.Join(supported, ", "))
+}
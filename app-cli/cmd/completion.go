@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"golang/app-cli/cmd/common"
+)
+
+// completionCmd generate the bash completion script
+var completionCmd = &cobra.Command{
+	Use:   "completion",
+	Short: "Print the bash completion script",
+	Long: `Print the bash completion script, load it in the current shell by:
+
+  source <(app-cli completion)`,
+	Annotations: noAuth,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return RootCmd.GenBashCompletion(common.GlobalFlag.Out())
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(completionCmd)
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"golang/app-cli/cmd/common"
+)
+
+var (
+	listService   string
+	listInterface string
+	listRegion    string
+	explain       bool
+)
+
+var catalogCmd = &cobra.Command{
+	Use:   "catalog",
+	Short: "Inspect the service catalog",
+}
+
+var catalogListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the services and their endpoints, from the token catalog or the identity api",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rows, err := common.GlobalFlag.Catalog(listInterface, listRegion)
+		if err != nil {
+			return err
+		}
+		return common.GlobalFlag.PrintObj(rows, []string{"name", "type", "endpoints"})
+	},
+}
+
+var endpointCmd = &cobra.Command{
+	Use:   "endpoint",
+	Short: "Inspect the service endpoints",
+}
+
+var endpointListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the endpoints, of all the services unless --service is set",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rows, err := common.GlobalFlag.Endpoints(listService, listInterface, listRegion)
+		if err != nil {
+			return err
+		}
+		return common.GlobalFlag.PrintObj(rows, []string{"id", "service_name", "interface", "region", "url"})
+	},
+}
+
+var endpointShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the endpoint the service requests are sent to",
+	Long: `Show the endpoint of the service, --service-name by default, chosen by
+--os-interface and --os-region-name, and the url of the api version
+negotiated with --os-api-version. --explain walks through how it's resolved.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if explain {
+			return common.GlobalFlag.ExplainEndpoint(listService, common.GlobalFlag.Out())
+		}
+
+		obj, err := common.GlobalFlag.ShowEndpoint(listService)
+		if err != nil {
+			return err
+		}
+		return common.GlobalFlag.PrintObj(obj, []string{"id", "service_name", "interface", "region", "version_url", "microversion"})
+	},
+}
+
+func init() {
+	for _, c := range []*cobra.Command{catalogListCmd, endpointListCmd} {
+		c.Flags().StringVar(&listInterface, "interface", "", "only the endpoints of this interface: public, internal or admin")
+		c.Flags().StringVar(&listRegion, "region", "", "only the endpoints of this region")
+	}
+	endpointListCmd.Flags().StringVar(&listService, "service", "", "only the endpoints of this service")
+	endpointShowCmd.Flags().StringVar(&listService, "service", "", "the service name, --service-name by default")
+	endpointShowCmd.Flags().BoolVar(&explain, "explain", false, "walk through the endpoint resolution, step by step")
+
+	catalogCmd.AddCommand(catalogListCmd)
+	endpointCmd.AddCommand(endpointListCmd, endpointShowCmd)
+	RootCmd.AddCommand(catalogCmd, endpointCmd)
+}
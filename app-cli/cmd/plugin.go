@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"golang/app-cli/cmd/common"
+	"golang/app-cli/cmd/common/plugin"
+)
+
+// the environment variables a plugin is run with, the token ones are
+// only set when the credentials are configured
+const (
+	EnvToken       = "APP_CLI_TOKEN"
+	EnvEndpoint    = "APP_CLI_ENDPOINT"
+	EnvAPIVersion  = "APP_CLI_API_VERSION"
+	EnvIdentityURL = "APP_CLI_IDENTITY_URL"
+	EnvOutput      = "APP_CLI_OUTPUT"
+	EnvColumns     = "APP_CLI_COLUMNS"
+)
+
+// annotationPlugin the annotation holding the path of a plugin command
+const annotationPlugin = "plugin"
+
+var pluginCmd = &cobra.Command{
+	Use:   "plugin",
+	Short: "Manage the app-cli-<name> plugins",
+	Long: fmt.Sprintf(`An executable named app-cli-<name> in the plugin directories, %s
+or the user config dir app-cli/plugins by default, or on PATH, is run by
+"app-cli <name>". The first one found is used.
+
+The global flags before the plugin args are read by app-cli, the plugin
+gets the resolved settings by the environment variables:
+  %s, %s, %s, %s, %s, %s`, "$"+plugin.DirEnv,
+		EnvToken, EnvEndpoint, EnvAPIVersion, EnvIdentityURL, EnvOutput, EnvColumns),
+	Annotations: noAuth,
+}
+
+var pluginListCmd = &cobra.Command{
+	Use:         "list",
+	Short:       "List the plugins found, and their name conflicts",
+	Annotations: noAuth,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		builtin := builtinCommands()
+
+		rows := []interface{}{}
+		for _, p := range plugin.Discover(plugin.Dirs()) {
+			status := "ok"
+			switch {
+			case p.ShadowedBy != "":
+				status = "shadowed by " + p.ShadowedBy
+			case builtin[p.Name]:
+				status = "conflicts with the builtin command " + p.Name
+			}
+			rows = append(rows, map[string]interface{}{
+				"name":   p.Name,
+				"path":   p.Path,
+				"status": status,
+			})
+		}
+
+		return common.GlobalFlag.PrintObj(rows, []string{"name", "path", "status"})
+	},
+}
+
+// builtinCommands the names and aliases of the commands not from plugins
+func builtinCommands() map[string]bool {
+	names := map[string]bool{"help": true}
+	for _, c := range RootCmd.Commands() {
+		if c.Annotations[annotationPlugin] != "" {
+			continue
+		}
+		names[c.Name()] = true
+		for _, a := range c.Aliases {
+			names[a] = true
+		}
+	}
+	return names
+}
+
+// addPlugins add a command for each plugin found, the builtin commands win
+func addPlugins() {
+	builtin := builtinCommands()
+	added := map[string]bool{}
+	for _, c := range RootCmd.Commands() {
+		added[c.Name()] = true
+	}
+
+	for _, p := range plugin.Discover(plugin.Dirs()) {
+		if p.ShadowedBy != "" || builtin[p.Name] || added[p.Name] {
+			continue
+		}
+		added[p.Name] = true
+		RootCmd.AddCommand(pluginCommand(p))
+	}
+}
+
+// pluginCommand the command running the plugin, its args are passed as
+// they are, but the leading global flags
+func pluginCommand(p plugin.Plugin) *cobra.Command {
+	var rest []string
+
+	return &cobra.Command{
+		Use:                p.Name,
+		Short:              "Plugin " + p.Path,
+		Annotations:        map[string]string{annotationPlugin: p.Path},
+		DisableFlagParsing: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			if rest, err = parseGlobalFlags(args); err != nil {
+				return err
+			}
+			return setup(cmd, rest)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			env, err := pluginEnv(cmd.OutOrStderr())
+			if err != nil {
+				return err
+			}
+
+			c := exec.CommandContext(common.GlobalFlag.Context(), p.Path, rest...)
+			c.Env = append(os.Environ(), env...)
+			c.Stdin = os.Stdin
+			c.Stdout = common.GlobalFlag.Out()
+			c.Stderr = os.Stderr
+
+			err = c.Run()
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				return &pluginExitError{name: p.Name, code: exitErr.ExitCode()}
+			}
+			return err
+		},
+	}
+}
+
+// pluginEnv the settings passed to a plugin, authenticate if the
+// credentials are configured. The endpoint is left empty if the service
+// is not found, the plugin may talk to other services
+func pluginEnv(stderr io.Writer) ([]string, error) {
+	env := []string{
+		EnvOutput + "=" + output,
+		EnvColumns + "=" + strings.Join(columns, ","),
+	}
+
+	if err := common.GlobalFlag.Authenticate(); err == errMissingAuth {
+		return env, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	env = append(env,
+		EnvToken+"="+common.GlobalFlag.GetToken(),
+		EnvIdentityURL+"="+common.GlobalFlag.KeystoneURL(),
+	)
+
+	endpoint, apiVersion := "", ""
+	if client, err := common.GlobalFlag.GetSDAClient(); err != nil {
+		fmt.Fprintf(stderr, "warning: %s is empty, resolve the service endpoint: %s\n", EnvEndpoint, err)
+	} else {
+		endpoint, apiVersion = client.URL, client.Headers.Get(common.APIVersionHeader)
+	}
+
+	return append(env,
+		EnvEndpoint+"="+endpoint,
+		EnvAPIVersion+"="+apiVersion,
+	), nil
+}
+
+// parseGlobalFlags set the global flags leading the args, and return
+// the args from the first one that is not a global flag
+func parseGlobalFlags(args []string) ([]string, error) {
+	flags := RootCmd.PersistentFlags()
+
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "-" && args[0] != "--" {
+		name, value := strings.TrimLeft(args[0], "-"), ""
+		hasValue := false
+		if i := strings.Index(name, "="); i >= 0 {
+			name, value, hasValue = name[:i], name[i+1:], true
+		}
+
+		var f *pflag.Flag
+		if strings.HasPrefix(args[0], "--") {
+			f = flags.Lookup(name)
+		} else if name != "" {
+			f = shorthand(flags, name[:1])
+			if f != nil && len(name) > 1 && !hasValue {
+				// -ojson
+				value, hasValue = name[1:], true
+			}
+		}
+		if f == nil {
+			break
+		}
+		args = args[1:]
+
+		if !hasValue {
+			if f.NoOptDefVal != "" {
+				value = f.NoOptDefVal
+			} else if len(args) == 0 {
+				return nil, fmt.Errorf("flag needs an argument: %s", f.Name)
+			} else {
+				value, args = args[0], args[1:]
+			}
+		}
+		if err := flags.Set(f.Name, value); err != nil {
+			return nil, fmt.Errorf("invalid argument %q for --%s: %s", value, f.Name, err)
+		}
+	}
+
+	return args, nil
+}
+
+func shorthand(flags *pflag.FlagSet, s string) *pflag.Flag {
+	var found *pflag.Flag
+	flags.VisitAll(func(f *pflag.Flag) {
+		if f.Shorthand == s {
+			found = f
+		}
+	})
+	return found
+}
+
+// pluginExitError the plugin exited with a non-zero code, app-cli exits with it
+type pluginExitError struct {
+	name string
+	code int
+}
+
+func (e *pluginExitError) Error() string {
+	return fmt.Sprintf("plugin %s exited with %d", e.name, e.code)
+}
+
+func (e *pluginExitError) ExitCode() int {
+	return e.code
+}
+
+func init() {
+	pluginCmd.AddCommand(pluginListCmd)
+	RootCmd.AddCommand(pluginCmd)
+}
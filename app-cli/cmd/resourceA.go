@@ -15,35 +15,30 @@
 package cmd
 
 import (
-	"fmt"
-
-	"github.com/spf13/cobra"
-
-	"golang/app-cli/cmd/resourceA"
+	"golang/app-cli/cmd/common/resource"
 )
 
-// resourceACmd represents the resourceA command
-var resourceACmd = &cobra.Command{
-	Use:   "resourceA",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		// TODO: Work your own magic here
-		fmt.Println("resourceA called")
+// resourceA the resourceA resource of the service
+var resourceA = &resource.Definition{
+	Name:     "resourceA",
+	Short:    "manage the resourceA resources",
+	Path:     "resourceAs",
+	Singular: "resourceA",
+	Plural:   "resourceAs",
+	Filters: []resource.Filter{
+		{Name: "name", Help: "only list the resources with this name"},
+		{Name: "status", Help: "only list the resources in this status"},
 	},
+	Fields: []resource.Field{
+		{Name: "name", Type: resource.String, Help: "the resource name", Required: true, Updatable: true},
+		{Name: "description", Type: resource.String, Help: "the resource description", Updatable: true},
+	},
+	Columns: []string{"id", "name", "status"},
 }
 
+// resourceACmd represents the resourceA command
+var resourceACmd = resourceA.Command()
+
 func init() {
 	RootCmd.AddCommand(resourceACmd)
-	resourceACmd.AddCommand(resourceA.CreateCmd,
-		resourceA.ListCmd,
-		resourceA.GetCmd,
-		resourceA.UpdateCmd,
-		resourceA.DeleteCmd)
-
 }
@@ -15,38 +15,33 @@
 package cmd
 
 import (
-	"fmt"
-
-	"github.com/spf13/cobra"
+	"golang/app-cli/cmd/common/resource"
 )
 
-// resourceBCmd represents the resourceB command
-var resourceBCmd = &cobra.Command{
-	Use:   "resourceB",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		// TODO: Work your own magic here
-		fmt.Println("resourceB called")
+// resourceB the resourceB resource of the service
+var resourceB = &resource.Definition{
+	Name:     "resourceB",
+	Short:    "manage the resourceB resources",
+	Path:     "resourceBs",
+	Singular: "resourceB",
+	Plural:   "resourceBs",
+	Filters: []resource.Filter{
+		{Name: "name", Help: "only list the resources with this name"},
+		{Name: "resource_a_id", Help: "only list the resources belong to this resourceA"},
 	},
+	Fields: []resource.Field{
+		{Name: "name", Type: resource.String, Help: "the resource name", Required: true, Updatable: true},
+		{Name: "resource_a_id", Type: resource.String, Help: "the resourceA it belongs to", Required: true},
+		{Name: "size", Type: resource.Int, Help: "the resource size", Updatable: true},
+		{Name: "enabled", Type: resource.Bool, Help: "whether the resource is enabled", Updatable: true},
+		{Name: "tags", Type: resource.List, Help: "the resource tags, eg: a,b", Updatable: true},
+	},
+	Columns: []string{"id", "name", "resource_a_id", "size", "enabled"},
 }
 
+// resourceBCmd represents the resourceB command
+var resourceBCmd = resourceB.Command()
+
 func init() {
 	RootCmd.AddCommand(resourceBCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// resourceBCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// resourceBCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
-
 }
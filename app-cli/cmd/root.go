@@ -15,14 +15,25 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"golang/app-cli/cmd/common"
+	"golang/app-cli/cmd/common/cassette"
+	"golang/app-cli/cmd/common/clouds"
 	"golang/app-cli/cmd/common/keystone"
+	"golang/app-cli/cmd/common/printer"
+	"golang/app-cli/cmd/common/trace"
 )
 
 var (
@@ -35,69 +46,536 @@ var (
 	authVersino     string
 	serviceEndPoint string
 	serviceName     string
+	serviceType     string
+	noTokenCache    bool
+	endpointIface   string
+	regionName      string
+	apiVersion      string
+	cloudName       string
+	authType        string
+	appCredID       string
+	appCredName     string
+	appCredSecret   string
+	osToken         string
+	userID          string
+	domianID        string
+	projectID       string
+	domianProjectID string
+	scopeDomain     string
+	scopeDomainID   string
+	unscoped        bool
+	output          string
+	columns         []string
+	retries         int
+	timeout         time.Duration
+	cancelTimeout   context.CancelFunc
+	debug           bool
+	record          string
+	replay          string
 )
 
+// identity and authReq the keystone client and the auth request, set once
+// a command asked for a client, common.GlobalFlag.Issued() is the token
+var (
+	identity keystone.IdentityAPI
+	authReq  keystone.Auth
+)
+
+// projectNameEnv and projectIDEnv the env vars of the project, by order,
+// OS_TENANT_NAME and OS_TENANT_ID are the v2.0 names of it
+var (
+	projectNameEnv = []string{"OS_PROJECT_NAME", "OS_TENANT_NAME"}
+	projectIDEnv   = []string{"OS_PROJECT_ID", "OS_TENANT_ID"}
+)
+
+// firstEnv the value of the first env var set
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// errMissingAuth the keystone auth parameters are incomplete
+var errMissingAuth = common.WithExitCode(errors.New(`the keystone auth parameter must not be empty, please set them 
+in your os environment or pass them through Global Flags!`), common.ExitAuth)
+
 // RootCmd represents the base command when called without any subcommands
 var RootCmd = &cobra.Command{
 	Use:   "app-cli",
-	Short: "A brief description of your application",
-	Long: `A longer description that spans multiple lines and likely contains
-examples and usage of using your application. For example:
+	Short: "Manage the service resources, authenticated by keystone",
+	Long: fmt.Sprintf(`app-cli manages the service resources, it authenticates by keystone
+and finds the service endpoint in the catalog.
+
+Exit codes:
+  0    ok
+  %d    any other error, eg: an invalid flag
+  %d    the credentials are missing or rejected, 401 and 403, or the
+       authentication failed otherwise, eg: a wrong --auth-url
+  %d    not found, 404
+  %d    conflict, 409 and 412
+  %d    the request is invalid, 400, 413 and 422
+  %d    --timeout or --wait-timeout expired, 408
+  %d    server error, 5xx and 429
+  %d    the resource went into a failure status
+  %d  interrupted`, common.ExitError, common.ExitAuth, common.ExitNotFound, common.ExitConflict,
+		common.ExitValidation, common.ExitTimeout, common.ExitServer, common.ExitResourceFailed, ExitInterrupted),
+	PersistentPreRunE: setup,
+}
+
+// ExitInterrupted the exit code when the cli is interrupted, as the shells do
+const ExitInterrupted = 130
+
+// setup check the global flags and apply the --debug and --timeout, the
+// authentication is deferred until the command asks for a client
+func setup(cmd *cobra.Command, args []string) error {
+	if _, err := printer.New(output, columns); err != nil {
+		return err
+	}
+
+	transport, err := newTransport()
+	if err != nil {
+		return err
+	}
+	common.HTTPClient.Transport = transport
+	keystone.HTTPClient.Transport = transport
+
+	if timeout > 0 {
+		var ctx context.Context
+		ctx, cancelTimeout = context.WithTimeout(common.GlobalFlag.Context(), timeout)
+		common.GlobalFlag.SetContext(ctx)
+	}
+
+	common.GlobalFlag.SetOutput(output, columns)
+	common.GlobalFlag.SetRetries(retries)
+
+	if !needAuth(cmd) {
+		common.GlobalFlag.SetAuthenticator(func() error {
+			return fmt.Errorf("%s works offline, it has no credentials", cmd.CommandPath())
+		})
+		return nil
+	}
+
+	if err := loadCloud(); err != nil {
+		return err
+	}
+	if _, err := common.NormalizeInterface(endpointIface); err != nil {
+		return err
+	}
+	common.GlobalFlag.SetEndpointFilter(endpointIface, regionName)
+	common.GlobalFlag.SetAPIVersion(apiVersion)
+	common.GlobalFlag.SetAuthenticator(func() error {
+		return auth(cmd, args)
+	})
+
+	return nil
+}
+
+// newTransport the transport of --record, --replay and --debug, nil if
+// none is set. The cached token is not used while recording or replaying,
+// the authentication must be in the cassette. A replay without --auth-url
+// uses the one of the cassette
+func newTransport() (http.RoundTripper, error) {
+	if record != "" && replay != "" {
+		return nil, fmt.Errorf("--record and --replay can not be used together")
+	}
+
+	var transport http.RoundTripper
+	switch {
+	case record != "":
+		r, err := cassette.NewRecorder(http.DefaultTransport, record)
+		if err != nil {
+			return nil, err
+		}
+		transport, noTokenCache = r, true
+	case replay != "":
+		c, err := cassette.Load(replay)
+		if err != nil {
+			return nil, err
+		}
+		transport, noTokenCache = cassette.NewPlayer(c), true
+		if authURL == "" {
+			var version string
+			authURL, version = c.Identity()
+			setDefault(&authVersino, version)
+		}
+	}
+
+	if debug {
+		t := trace.NewTransport(os.Stderr)
+		if transport != nil {
+			t.Base = transport
+		}
+		transport = t
+	}
+	return transport, nil
+}
+
+// annotationAuth the command annotation telling if it needs a token,
+// set it to "false" for the commands working offline
+const annotationAuth = "auth"
 
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-	PersistentPreRunE: auth,
+// noAuth the annotations of the commands never talking to the apis
+var noAuth = map[string]string{annotationAuth: "false"}
+
+// needAuth the command needs a token unless it or a parent declares not
+func needAuth(cmd *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		if c.Annotations[annotationAuth] == "false" {
+			return false
+		}
+	}
+	return true
 }
 
+// auth get the token and catalog, and set up the re-authentication
 func auth(cmd *cobra.Command, args []string) error {
-	if user == "" || pass == "" || project == "" ||
-		domian == "" || domianProject == "" ||
-		authURL == "" || authVersino == "" {
-		err := `the keystone auth parameter must not be empty, please set them 
-in your os environment or pass them through Global Flags!`
-		return errors.New(err)
+	if authURL == "" {
+		return errMissingAuth
 	}
 
 	if serviceEndPoint == "" && serviceName == "" {
 		serviceName = "keystoneServiceName"
 	}
 
-	client, err := keystone.NewClient(authURL)
+	client, cached, err := newIdentity()
 	if err != nil {
+		return authError(err)
+	}
+
+	auth, err := buildAuth(client.Version())
+	if err != nil && replay == "" {
 		return err
+	} else if err != nil {
+		// the player ignores the request bodies, no credentials are needed
+		auth = keystone.NewAuth(keystone.User{Name: trace.Redacted, Password: trace.Redacted}, nil)
+	}
+
+	token, err := getToken(client, auth)
+	if err != nil {
+		if cached {
+			// the discovered identity may be stale, discover it again next time
+			tokenCache().DeleteIdentity(authURL)
+		}
+		return authError(err)
+	}
+
+	identity, authReq = client, auth
+	common.GlobalFlag.SetIssued(token)
+	common.GlobalFlag.SetKeystoneURL(client.BaseURL())
+	common.GlobalFlag.SetSDAServiceName(serviceName)
+	common.GlobalFlag.SetSDAServiceType(serviceType)
+	common.GlobalFlag.SetSDAEndPoint(serviceEndPoint)
+	common.GlobalFlag.SetReAuth(func() (*keystone.Token, error) {
+		return issueToken(client, auth)
+	})
+
+	return nil
+}
+
+// authError exit with common.ExitAuth when keystone failed to authenticate,
+// eg: a wrong --auth-url answering 404 is not a missing resource. The
+// timeouts and the server errors keep their exit codes
+func authError(err error) error {
+	switch common.ExitCode(err) {
+	case common.ExitAuth, common.ExitTimeout, common.ExitServer:
+		return err
+	}
+	return common.WithExitCode(err, common.ExitAuth)
+}
+
+// newIdentity the identity api client of the auth url, the version the
+// auth url was discovered to speak is kept in the token cache, so reusing
+// a cached token sends no request at all. It tells if the cached one is used
+func newIdentity() (keystone.IdentityAPI, bool, error) {
+	ctx := common.GlobalFlag.Context()
+	if authVersino != "" || noTokenCache {
+		client, err := keystone.NewIdentity(ctx, authURL, authVersino)
+		return client, false, err
+	}
+
+	if id, ok := tokenCache().GetIdentity(authURL); ok {
+		client, err := keystone.NewVersionedIdentity(id.URL, id.Version)
+		return client, err == nil, err
+	}
+
+	client, err := keystone.NewIdentity(ctx, authURL, "")
+	if err != nil {
+		return nil, false, err
+	}
+	id := keystone.CachedIdentity{Version: client.Version(), URL: client.BaseURL()}
+	if err := tokenCache().PutIdentity(authURL, id); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: cache the identity api version failed: %s\n", err)
+	}
+	return client, false, nil
+}
+
+// buildAuth build the keystone auth by --os-auth-type for the identity
+// api version, v2.0 has no domains
+func buildAuth(version string) (keystone.Auth, error) {
+	if authType == "" && appCredSecret != "" {
+		authType = keystone.MethodApplicationCredential
+	}
+
+	userDomain := keystone.NewDomain(domianID, domian)
+	hasDomains := version != "2.0"
+
+	switch authMethod(authType) {
+	case keystone.MethodPassword:
+		if (user == "" && userID == "") || pass == "" ||
+			(userID == "" && userDomain == nil && hasDomains) {
+			return keystone.Auth{}, errMissingAuth
+		}
+		scope, err := buildScope(userDomain, hasDomains)
+		if err != nil {
+			return keystone.Auth{}, err
+		}
+		return keystone.NewAuth(newUser(userDomain, pass), scope), nil
+
+	case keystone.MethodApplicationCredential:
+		var owner *keystone.User
+		if user != "" || userID != "" {
+			u := newUser(userDomain, "")
+			owner = &u
+		}
+		return keystone.NewApplicationCredentialAuth(appCredID, appCredName, appCredSecret, owner)
+
+	case keystone.MethodToken:
+		if osToken == "" {
+			return keystone.Auth{}, errors.New("the token auth type needs --os-token")
+		}
+		scope, err := buildScope(userDomain, hasDomains)
+		if err != nil {
+			return keystone.Auth{}, err
+		}
+		return keystone.NewTokenAuth(osToken, scope), nil
+	}
+
+	return keystone.Auth{}, fmt.Errorf("unsupported auth type %q, must be one of password, application_credential, token", authType)
+}
+
+// newUser the user identified by --user-id, or by --username in its domain
+func newUser(domain *keystone.Domain, password string) keystone.User {
+	if userID != "" {
+		return keystone.User{ID: userID, Password: password}
+	}
+	return keystone.User{Name: user, Domain: domain, Password: password}
+}
+
+// buildScope scope the token to the project, or to the domain given by
+// --domain-name/--domain-id, or nothing when --unscoped. Without domains,
+// in v2.0, the project is the tenant
+func buildScope(userDomain *keystone.Domain, hasDomains bool) (*keystone.Scope, error) {
+	if unscoped {
+		return nil, nil
+	}
+	if !hasDomains {
+		if p := keystone.NewProject(projectID, project, nil); p != nil {
+			return &keystone.Scope{Project: p}, nil
+		}
+	}
+
+	domain := keystone.NewDomain(scopeDomainID, scopeDomain)
+	if domain != nil && projectID == "" && project == "" {
+		return keystone.NewScope(nil, domain)
+	}
+
+	// the project is looked up in the user's domain if its own is not given
+	projectDomain := keystone.NewDomain(domianProjectID, domianProject)
+	if projectDomain == nil {
+		projectDomain = userDomain
+	}
+
+	p := keystone.NewProject(projectID, project, projectDomain)
+	if p == nil {
+		return nil, errors.New(`no project to scope to, set --project-name or --project-id,
+or --domain-name/--domain-id for a domain scoped token, or --unscoped`)
+	}
+
+	return keystone.NewScope(p, nil)
+}
+
+// authMethod map the auth type, include the keystoneauth plugin names
+// like v3password, to the keystone identity method
+func authMethod(t string) string {
+	switch strings.ToLower(t) {
+	case "", "password", "v3password":
+		return keystone.MethodPassword
+	case "application_credential", "v3applicationcredential":
+		return keystone.MethodApplicationCredential
+	case "token", "v3token":
+		return keystone.MethodToken
+	}
+	return t
+}
+
+// loadCloud fill the settings not given by flags or env from the
+// --os-cloud profile, so the precedence is flags > env > profile
+func loadCloud() error {
+	if cloudName == "" {
+		return nil
 	}
 
-	auth := keystone.NewAuth(user, pass, domian, project)
-	token, err := client.GetToken(auth)
+	cloud, err := clouds.Load(cloudName)
 	if err != nil {
 		return err
 	}
 
-	common.GlobalFlag.SetToken(token)
-	common.GlobalFlag.SetKeystoneURL(authURL)
+	setDefault(&user, cloud.Auth.Username)
+	setDefault(&pass, cloud.Auth.Password)
+	setDefault(&project, cloud.Auth.ProjectName)
+	setDefault(&domian, cloud.Auth.UserDomainName)
+	setDefault(&domianProject, cloud.Auth.ProjectDomainName)
+	setDefault(&authURL, cloud.Auth.AuthURL)
+	setDefault(&authVersino, cloud.IdentityAPIVersion)
+	setDefault(&endpointIface, cloud.Interface)
+	setDefault(&regionName, cloud.RegionName)
+	setDefault(&authType, cloud.AuthType)
+	setDefault(&appCredID, cloud.Auth.ApplicationCredentialID)
+	setDefault(&appCredName, cloud.Auth.ApplicationCredentialName)
+	setDefault(&appCredSecret, cloud.Auth.ApplicationCredentialSecret)
+	setDefault(&osToken, cloud.Auth.Token)
+	setDefault(&userID, cloud.Auth.UserID)
+	setDefault(&domianID, cloud.Auth.UserDomainID)
+	setDefault(&projectID, cloud.Auth.ProjectID)
+	setDefault(&domianProjectID, cloud.Auth.ProjectDomainID)
+	setDefault(&scopeDomain, cloud.Auth.DomainName)
+	setDefault(&scopeDomainID, cloud.Auth.DomainID)
 
 	return nil
 }
 
+func setDefault(v *string, def string) {
+	if *v == "" {
+		*v = def
+	}
+}
+
+// getToken reuse the cached token of this user, project, auth url and
+// identity api version, authenticate only when it's missing or close to
+// expiring
+func getToken(client keystone.IdentityAPI, auth keystone.Auth) (*keystone.Token, error) {
+	if !noTokenCache {
+		if token, ok := tokenCache().Get(cacheKey(client, auth)); ok {
+			return token, nil
+		}
+	}
+
+	return issueToken(client, auth)
+}
+
+// issueToken authenticate against keystone, and cache the new token
+func issueToken(client keystone.IdentityAPI, auth keystone.Auth) (*keystone.Token, error) {
+	key := cacheKey(client, auth)
+	if !noTokenCache {
+		// the cached one is rejected or expired, never reuse it
+		tokenCache().Delete(key)
+	}
+
+	token, err := client.GetToken(common.GlobalFlag.Context(), auth)
+	if err != nil {
+		return nil, err
+	}
+
+	if !noTokenCache {
+		if err := tokenCache().Put(key, token); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: cache token failed: %s\n", err)
+		}
+	}
+
+	return token, nil
+}
+
+// cacheKey the key of the tokens issued by client for auth
+func cacheKey(client keystone.IdentityAPI, auth keystone.Auth) string {
+	return keystone.CacheKey(authURL, client.Version(), auth)
+}
+
+func tokenCache() *keystone.TokenCache {
+	return keystone.NewTokenCache(keystone.DefaultTokenCacheDir())
+}
+
 // Execute adds all child commands to the root command sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := RootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(-1)
+	// cancel the in-flight requests on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	stopOnDone(ctx, stop)
+	addPlugins()
+	code := runRoot(ctx, os.Stderr)
+	stop()
+
+	if code != 0 {
+		os.Exit(code)
+	}
+}
+
+// stopOnDone call stop once ctx is done, so after the first Ctrl-C the
+// signals are not caught any more and a second one kills a command stuck
+// on cleaning up
+func stopOnDone(ctx context.Context, stop func()) {
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+}
+
+// runRoot run the root command with ctx, print the error to stderr and
+// return the exit code, ExitInterrupted once ctx is canceled
+func runRoot(ctx context.Context, stderr io.Writer) int {
+	common.GlobalFlag.SetContext(ctx)
+
+	err := RootCmd.Execute()
+	if cancelTimeout != nil {
+		cancelTimeout()
+	}
+
+	if ctx.Err() != nil {
+		fmt.Fprintln(stderr, "interrupted")
+		return ExitInterrupted
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
 	}
+	return common.ExitCode(err)
 }
 
 func init() {
 	RootCmd.PersistentFlags().StringVar(&user, "username", os.Getenv("OS_USERNAME"), "keystone auth user")
 	RootCmd.PersistentFlags().StringVar(&pass, "password", os.Getenv("OS_PASSWORD"), "keystone auth user password")
-	RootCmd.PersistentFlags().StringVar(&project, "project-name", os.Getenv("OS_PROJECT_NAME"), "keystone auth user project name")
+	RootCmd.PersistentFlags().StringVar(&project, "project-name", firstEnv(projectNameEnv...), "keystone auth user project name")
 	RootCmd.PersistentFlags().StringVar(&domian, "user-domain-name", os.Getenv("OS_USER_DOMAIN_NAME"), "keystone auth user domain name")
 	RootCmd.PersistentFlags().StringVar(&domianProject, "project-domain-name", os.Getenv("OS_PROJECT_DOMAIN_NAME"), "keystone auth user project domain")
+	RootCmd.PersistentFlags().StringVar(&userID, "user-id", os.Getenv("OS_USER_ID"), "keystone auth user id, instead of --username and its domain")
+	RootCmd.PersistentFlags().StringVar(&domianID, "user-domain-id", os.Getenv("OS_USER_DOMAIN_ID"), "keystone auth user domain id")
+	RootCmd.PersistentFlags().StringVar(&projectID, "project-id", firstEnv(projectIDEnv...), "keystone auth user project id, instead of --project-name and its domain")
+	RootCmd.PersistentFlags().StringVar(&domianProjectID, "project-domain-id", os.Getenv("OS_PROJECT_DOMAIN_ID"), "keystone auth user project domain id")
+	RootCmd.PersistentFlags().StringVar(&scopeDomain, "domain-name", os.Getenv("OS_DOMAIN_NAME"), "scope the token to this domain instead of a project")
+	RootCmd.PersistentFlags().StringVar(&scopeDomainID, "domain-id", os.Getenv("OS_DOMAIN_ID"), "scope the token to this domain id instead of a project")
+	RootCmd.PersistentFlags().BoolVar(&unscoped, "unscoped", false, "issue an unscoped token")
 	RootCmd.PersistentFlags().StringVar(&authURL, "auth-url", os.Getenv("OS_AUTH_URL"), "keyston auth url")
-	RootCmd.PersistentFlags().StringVar(&authVersino, "idenntity-api-version", os.Getenv("OS_IDENTITY_API_VERSION"), "keystone auth version")
+	RootCmd.PersistentFlags().StringVar(&authVersino, "idenntity-api-version", os.Getenv("OS_IDENTITY_API_VERSION"), "keystone auth version: 3 or 2.0, discovered from the auth url if not set")
 	RootCmd.PersistentFlags().StringVar(&serviceEndPoint, "api-endpoint", os.Getenv("SERVICE_ENDPOIN"), "service endpoint")
 	RootCmd.PersistentFlags().StringVar(&serviceName, "service-name", os.Getenv("SERVICE_NAME"), "keystone service name")
+	RootCmd.PersistentFlags().StringVar(&serviceType, "service-type", os.Getenv("SERVICE_TYPE"), "service type the microversion is requested for with --api-endpoint, the catalog's by default")
+	RootCmd.PersistentFlags().StringVar(&endpointIface, "os-interface", os.Getenv("OS_INTERFACE"), "endpoint interface: public, internal or admin (default public)")
+	RootCmd.PersistentFlags().StringVar(&regionName, "os-region-name", os.Getenv("OS_REGION_NAME"), "endpoint region name")
+	RootCmd.PersistentFlags().StringVar(&apiVersion, "os-api-version", os.Getenv("OS_API_VERSION"), "service api version or microversion to use, eg: 1, 1.5 or latest")
+	RootCmd.PersistentFlags().StringVar(&cloudName, "os-cloud", os.Getenv("OS_CLOUD"), "named cloud profile in clouds.yaml")
+	RootCmd.PersistentFlags().StringVar(&authType, "os-auth-type", os.Getenv("OS_AUTH_TYPE"), "keystone auth method: password, application_credential or token (default password)")
+	RootCmd.PersistentFlags().StringVar(&appCredID, "os-application-credential-id", os.Getenv("OS_APPLICATION_CREDENTIAL_ID"), "keystone application credential id")
+	RootCmd.PersistentFlags().StringVar(&appCredName, "os-application-credential-name", os.Getenv("OS_APPLICATION_CREDENTIAL_NAME"), "keystone application credential name, needs --username")
+	RootCmd.PersistentFlags().StringVar(&appCredSecret, "os-application-credential-secret", os.Getenv("OS_APPLICATION_CREDENTIAL_SECRET"), "keystone application credential secret")
+	RootCmd.PersistentFlags().StringVar(&osToken, "os-token", os.Getenv("OS_TOKEN"), "existing keystone token, used by the token auth method")
+	RootCmd.PersistentFlags().StringVarP(&output, "output", "o", "table", "output format: "+strings.Join(printer.Formats, ", "))
+	RootCmd.PersistentFlags().StringSliceVar(&columns, "columns", nil, "the columns of the table output, eg: id,name,status")
+	RootCmd.PersistentFlags().IntVar(&retries, "retries", common.DefaultRetryPolicy.MaxRetries, "how many times an idempotent request is retried on connection errors, 429 and 503")
+	RootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 0, "give up the whole command after this duration, eg: 30s, 0 means no timeout")
+	RootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "log every http request and response to stderr, with the curl command reproducing it")
+	RootCmd.PersistentFlags().StringVar(&record, "record", "", "save every http request and response to this cassette file, the tokens and secrets redacted")
+	RootCmd.PersistentFlags().StringVar(&replay, "replay", "", "answer the http requests from this cassette file, without touching the network, no credentials needed")
+	RootCmd.PersistentFlags().BoolVar(&noTokenCache, "no-token-cache", false, "always authenticate, do not reuse the cached keystone token")
 
 }
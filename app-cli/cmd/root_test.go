@@ -0,0 +1,937 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"golang/app-cli/cmd/common"
+	"golang/app-cli/cmd/common/apierror"
+	"golang/app-cli/cmd/common/cassette"
+	"golang/app-cli/cmd/common/keystone/keystonetest"
+	"golang/app-cli/cmd/common/plugin"
+	"golang/app-cli/cmd/common/resource"
+)
+
+// newServer start a fake keystone serving the resourceA and resourceB apis
+func newServer(t *testing.T) (*keystonetest.Server, *keystonetest.ResourceAPI) {
+	srv := keystonetest.NewServer()
+	t.Cleanup(srv.Close)
+
+	apiA := keystonetest.NewResourceAPI(resourceA.Path, resourceA.Singular, resourceA.Plural)
+	srv.Handle(apiA.Path, apiA)
+	apiB := keystonetest.NewResourceAPI(resourceB.Path, resourceB.Singular, resourceB.Plural)
+	srv.Handle(apiB.Path, apiB)
+
+	return srv, apiA
+}
+
+// resetFlags put every flag back to its default, the flags keep their
+// values between the Execute calls otherwise
+func resetFlags(cmd *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		if f.Value.Type() != "stringSlice" {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+	cmd.PersistentFlags().VisitAll(reset)
+	cmd.Flags().VisitAll(reset)
+
+	for _, c := range cmd.Commands() {
+		resetFlags(c)
+	}
+}
+
+// run the cli against the fake keystone as alice, return what it printed
+func run(t *testing.T, srv *keystonetest.Server, args ...string) (string, error) {
+	return execute(t, authArgs(srv, args...)...)
+}
+
+// authArgs the flags authenticating as alice against the fake keystone, then args
+func authArgs(srv *keystonetest.Server, args ...string) []string {
+	return append([]string{
+		"--auth-url", srv.IdentityURL(),
+		"--username", keystonetest.DefaultUser,
+		"--password", keystonetest.DefaultPassword,
+		"--user-domain-name", keystonetest.DefaultDomain,
+		"--project-name", keystonetest.DefaultProject,
+		"--project-domain-name", keystonetest.DefaultDomain,
+		"--service-name", keystonetest.DefaultService,
+		"--no-token-cache",
+	}, args...)
+}
+
+// execute run the cli with the args only, return what it printed
+func execute(t *testing.T, args ...string) (string, error) {
+	out := prepare(args)
+	err := RootCmd.Execute()
+	return out.String(), err
+}
+
+// prepare reset the flags and set the args, return the output buffer
+func prepare(args []string) *bytes.Buffer {
+	resetFlags(RootCmd)
+	columns, manifests = nil, nil
+
+	out := &bytes.Buffer{}
+	common.GlobalFlag.SetOut(out)
+	RootCmd.SetOutput(ioutil.Discard)
+
+	RootCmd.SetArgs(args)
+	return out
+}
+
+func TestAuth(t *testing.T) {
+	srv, _ := newServer(t)
+
+	if _, err := run(t, srv, "resourceA", "list"); err != nil {
+		t.Fatalf("list failed: %s", err)
+	}
+	if got := common.GlobalFlag.GetToken(); got == "" {
+		t.Fatal("no token set after auth")
+	}
+	if n := srv.Count("POST /v3/auth/tokens"); n != 1 {
+		t.Errorf("want 1 auth request, got %d", n)
+	}
+
+	if _, err := run(t, srv, "--password", "wrong", "resourceA", "list"); err == nil ||
+		!strings.Contains(err.Error(), "401") {
+		t.Errorf("want 401 with a wrong password, got %v", err)
+	}
+}
+
+// the cached token and the discovered identity api version are reused,
+// a second run sends no request to keystone
+func TestTokenCache(t *testing.T) {
+	srv, _ := newServer(t)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	args := authArgs(srv)
+	args = args[:len(args)-1] // without --no-token-cache
+	for i := 0; i < 2; i++ {
+		if _, err := execute(t, append(args, "resourceA", "list")...); err != nil {
+			t.Fatalf("list %d failed: %s", i, err)
+		}
+	}
+	if n, m := srv.Count("GET /v3"), srv.Count("POST /v3/auth/tokens"); n != 1 || m != 1 {
+		t.Errorf("want 1 discovery and 1 auth request, got %d and %d", n, m)
+	}
+
+	// the version given, nothing to discover
+	if _, err := execute(t, append(args, "--idenntity-api-version", "3", "resourceA", "list")...); err != nil {
+		t.Fatalf("list with the version failed: %s", err)
+	}
+	if n, m := srv.Count("GET /v3"), srv.Count("POST /v3/auth/tokens"); n != 1 || m != 1 {
+		t.Errorf("want the cached token reused, got %d discoveries and %d auth requests", n, m)
+	}
+}
+
+func TestAuthV2(t *testing.T) {
+	srv, api := newServer(t)
+	api.Add(map[string]interface{}{"name": "v2"})
+	t.Setenv("OS_PROJECT_NAME", "")
+	t.Setenv("OS_TENANT_NAME", keystonetest.DefaultProject)
+	envDefault(t, "project-name", firstEnv(projectNameEnv...))
+
+	// no domains in v2.0, the tenant is the project
+	out, err := execute(t,
+		"--auth-url", srv.URL+"/v2.0",
+		"--username", keystonetest.DefaultUser,
+		"--password", keystonetest.DefaultPassword,
+		"--service-name", keystonetest.DefaultService,
+		"--no-token-cache",
+		"resourceA", "list", "-o", "jsonpath={[*].name}")
+	if err != nil {
+		t.Fatalf("list by a v2.0 token failed: %s", err)
+	}
+	if strings.TrimSpace(out) != "v2" || srv.Count("POST /v2.0/tokens") != 1 {
+		t.Errorf("want the list by a v2.0 token, got %q", out)
+	}
+}
+
+// envDefault set the default of a flag as its env var would, the env vars
+// are read once at init
+func envDefault(t *testing.T, name, value string) {
+	f := RootCmd.PersistentFlags().Lookup(name)
+	old := f.DefValue
+	f.DefValue = value
+	t.Cleanup(func() {
+		f.DefValue = old
+		f.Value.Set(old)
+	})
+}
+
+// the precedence is flags > env > secure.yaml > clouds.yaml
+func TestOSCloud(t *testing.T) {
+	srv, _ := newServer(t)
+	xdg := t.TempDir()
+	t.Chdir(t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	t.Setenv("OS_CLIENT_CONFIG_FILE", "")
+	t.Setenv("OS_CLIENT_SECURE_FILE", "")
+
+	dir := filepath.Join(xdg, "openstack")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"clouds.yaml": fmt.Sprintf(`clouds:
+  test:
+    auth:
+      auth_url: %s
+      username: bob
+      password: wrong
+      project_name: nope
+      user_domain_name: Default
+      project_domain_name: Default
+`, srv.IdentityURL()),
+		"secure.yaml": "clouds:\n  test:\n    auth:\n      password: " + keystonetest.DefaultPassword + "\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	envDefault(t, "username", "carol")
+	envDefault(t, "project-name", keystonetest.DefaultProject)
+
+	list := func(args ...string) error {
+		_, err := execute(t, append([]string{
+			"--os-cloud", "test", "--service-name", keystonetest.DefaultService, "--no-token-cache",
+			"resourceA", "list"}, args...)...)
+		return err
+	}
+	if err := list("--username", keystonetest.DefaultUser); err != nil {
+		t.Fatalf("want alice of the flag, demo of the env and the password of secure.yaml, got %s", err)
+	}
+	if err := list(); common.ExitCode(err) != common.ExitAuth {
+		t.Errorf("want carol of the env over bob of clouds.yaml rejected, got %v", err)
+	}
+	if err := list("--username", keystonetest.DefaultUser, "--project-name", "nope"); common.ExitCode(err) != common.ExitAuth {
+		t.Errorf("want the project of the flag over the env rejected, got %v", err)
+	}
+	if err := list("--os-cloud", "missing"); err == nil || !strings.Contains(err.Error(), "cloud missing not found") {
+		t.Errorf("want a missing cloud to fail, got %v", err)
+	}
+
+	// OS_TENANT_NAME is the env var of the project too, after OS_PROJECT_NAME
+	t.Setenv("OS_PROJECT_NAME", "")
+	t.Setenv("OS_TENANT_NAME", keystonetest.DefaultProject)
+	envDefault(t, "project-name", firstEnv(projectNameEnv...))
+	if err := list("--username", keystonetest.DefaultUser); err != nil {
+		t.Errorf("want the project of OS_TENANT_NAME over clouds.yaml, got %s", err)
+	}
+	t.Setenv("OS_PROJECT_NAME", "nope")
+	envDefault(t, "project-name", firstEnv(projectNameEnv...))
+	if err := list("--username", keystonetest.DefaultUser); common.ExitCode(err) != common.ExitAuth {
+		t.Errorf("want the project of OS_PROJECT_NAME over OS_TENANT_NAME rejected, got %v", err)
+	}
+}
+
+func TestAuthProjectInOtherDomain(t *testing.T) {
+	srv, _ := newServer(t)
+	srv.Projects = append(srv.Projects, keystonetest.Project{
+		ID: "p-ops", Name: "ops", Domain: keystonetest.Domain{ID: "d-ops", Name: "Ops"},
+	})
+	srv.Users[0].Projects = append(srv.Users[0].Projects, "p-ops")
+
+	if _, err := run(t, srv, "--project-name", "ops", "--project-domain-name", "Ops", "resourceA", "list"); err != nil {
+		t.Fatalf("auth to a project in another domain failed: %s", err)
+	}
+}
+
+func TestAuthApplicationCredential(t *testing.T) {
+	srv, _ := newServer(t)
+	srv.ApplicationCredentials = append(srv.ApplicationCredentials, keystonetest.ApplicationCredential{
+		ID: "ac-1", Secret: "robot", UserID: "u-alice", Project: "p-demo",
+	})
+
+	_, err := run(t, srv,
+		"--os-application-credential-id", "ac-1",
+		"--os-application-credential-secret", "robot",
+		"resourceA", "list")
+	if err != nil {
+		t.Fatalf("application credential auth failed: %s", err)
+	}
+}
+
+func TestResourceCRUD(t *testing.T) {
+	srv, api := newServer(t)
+
+	out, err := run(t, srv, "resourceA", "create", "--name", "first", "-o", "jsonpath={.id}")
+	if err != nil {
+		t.Fatalf("create failed: %s", err)
+	}
+	id := strings.TrimSpace(out)
+	if obj, ok := api.Get(id); !ok || obj["name"] != "first" {
+		t.Fatalf("resource %q not created: %v", id, obj)
+	}
+
+	if out, err = run(t, srv, "resourceA", "list"); err != nil {
+		t.Fatalf("list failed: %s", err)
+	}
+	if !strings.Contains(out, "ID") || !strings.Contains(out, id) || !strings.Contains(out, "first") {
+		t.Errorf("list table missing the resource:\n%s", out)
+	}
+
+	if _, err = run(t, srv, "resourceA", "update", id, "--description", "changed"); err != nil {
+		t.Fatalf("update failed: %s", err)
+	}
+	if obj, _ := api.Get(id); obj["description"] != "changed" {
+		t.Errorf("resource not updated: %v", obj)
+	}
+
+	if out, err = run(t, srv, "resourceA", "get", id, "-o", "json"); err != nil {
+		t.Fatalf("get failed: %s", err)
+	}
+	if !strings.Contains(out, `"description": "changed"`) {
+		t.Errorf("get json missing the description:\n%s", out)
+	}
+
+	if _, err = run(t, srv, "resourceA", "delete", id); err != nil {
+		t.Fatalf("delete failed: %s", err)
+	}
+	if api.Len() != 0 {
+		t.Errorf("resource not deleted")
+	}
+
+	_, err = run(t, srv, "resourceA", "get", id)
+	var apiErr *apierror.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 404 || apiErr.RequestID == "" ||
+		common.ExitCode(err) != common.ExitNotFound {
+		t.Errorf("want a 404 api error with a request id for a deleted resource, got %v", err)
+	}
+}
+
+func TestResourceCreateRequiredField(t *testing.T) {
+	srv, _ := newServer(t)
+
+	if _, err := run(t, srv, "resourceB", "create", "--name", "b"); err == nil ||
+		!strings.Contains(err.Error(), "--resource-a-id") {
+		t.Errorf("want the missing required flag reported, got %v", err)
+	}
+	if n := srv.Count("POST /v3/auth/tokens"); n != 0 {
+		t.Errorf("want no auth before the request is valid, got %d", n)
+	}
+}
+
+func TestOfflineCommands(t *testing.T) {
+	for _, args := range [][]string{
+		{"version"},
+		{"completion"},
+		{"help", "resourceA"},
+		{"resourceA", "list", "--help"},
+	} {
+		resetFlags(RootCmd)
+		out := &bytes.Buffer{}
+		common.GlobalFlag.SetOut(out)
+		RootCmd.SetOutput(ioutil.Discard)
+		RootCmd.SetArgs(args)
+
+		if err := RootCmd.Execute(); err != nil {
+			t.Errorf("%v without credentials failed: %s", args, err)
+		}
+	}
+}
+
+func TestResourceListPages(t *testing.T) {
+	srv, api := newServer(t)
+	api.MaxPageSize = 2
+	for i := 1; i <= 5; i++ {
+		api.Add(map[string]interface{}{"name": fmt.Sprintf("a%d", i)})
+	}
+	path := "GET /sda/v1/resourceAs"
+
+	out, err := run(t, srv, "resourceA", "list")
+	if err != nil {
+		t.Fatalf("list failed: %s", err)
+	}
+	if n := strings.Count(out, "resourceA-"); n != 2 {
+		t.Errorf("want the first page of 2, got %d:\n%s", n, out)
+	}
+
+	before := srv.Count(path)
+	if out, err = run(t, srv, "resourceA", "list", "--all"); err != nil {
+		t.Fatalf("list --all failed: %s", err)
+	}
+	if n := strings.Count(out, "resourceA-"); n != 5 {
+		t.Errorf("want all 5 by following the next links, got %d:\n%s", n, out)
+	}
+	if n := strings.Count(out, "NAME"); n != 1 {
+		t.Errorf("want the header once, got %d", n)
+	}
+	if n := srv.Count(path) - before; n != 3 {
+		t.Errorf("want 3 pages requested, got %d", n)
+	}
+
+	if out, err = run(t, srv, "resourceA", "list", "--limit", "3", "--page-size", "2", "-o", "jsonpath={range .[*]}{.name} {end}"); err != nil {
+		t.Fatalf("list --limit failed: %s", err)
+	}
+	if got := strings.Join(strings.Fields(out), " "); got != "a1 a2 a3" {
+		t.Errorf("want a1 a2 a3, got %q", got)
+	}
+
+	if out, err = run(t, srv, "resourceA", "list", "--marker", "resourceA-3", "--all", "-o", "json"); err != nil {
+		t.Fatalf("list --marker failed: %s", err)
+	}
+	var items []map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &items); err != nil {
+		t.Fatalf("want one json list, got %s:\n%s", err, out)
+	}
+	if len(items) != 2 || items[0]["name"] != "a4" {
+		t.Errorf("want a4 and a5 after the marker, got %v", items)
+	}
+}
+
+func TestApply(t *testing.T) {
+	srv, apiA := newServer(t)
+	old := apiA.Add(map[string]interface{}{"name": "old"})
+	web := apiA.Add(map[string]interface{}{"name": "web", "description": "v1"})
+
+	dir := t.TempDir()
+	write := func(name, data string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.yaml", `
+kind: resourceA
+name: web
+description: v2
+---
+kind: resourceA
+name: api
+`)
+	write("b.json", `{"kind": "resourceB", "name": "disk", "resource_a_id": "`+web+`", "size": 10, "tags": ["x"]}`)
+
+	out, err := run(t, srv, "apply", "-f", dir, "--prune", "--dry-run")
+	if err != nil {
+		t.Fatalf("dry run failed: %s", err)
+	}
+	for _, want := range []string{
+		"~ resourceA web (" + web + ")", `description: "v1" -> "v2"`, "+ resourceA api",
+		"+ resourceB disk", "- resourceA old (" + old + ")", "2 created, 1 updated, 1 deleted, 0 unchanged (dry run)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("dry run missing %q:\n%s", want, out)
+		}
+	}
+	if apiA.Len() != 2 {
+		t.Fatalf("dry run changed the resources")
+	}
+
+	if out, err = run(t, srv, "apply", "-f", dir, "--prune"); err != nil {
+		t.Fatalf("apply failed: %s\n%s", err, out)
+	}
+	if obj, _ := apiA.Get(web); obj["description"] != "v2" {
+		t.Errorf("web not updated: %v", obj)
+	}
+	if _, ok := apiA.Get(old); ok || apiA.Len() != 2 {
+		t.Errorf("old not pruned")
+	}
+
+	if out, err = run(t, srv, "apply", "-f", dir); err != nil {
+		t.Fatalf("apply again failed: %s", err)
+	}
+	if want := "0 created, 0 updated, 0 deleted, 3 unchanged"; !strings.Contains(out, want) {
+		t.Errorf("want %q applying again, got:\n%s", want, out)
+	}
+
+	write("c.yaml", "kind: resourceB\nname: bad\nsize: ten\n")
+	if _, err = run(t, srv, "apply", "-f", dir); err == nil || !strings.Contains(err.Error(), "c.yaml#1") {
+		t.Errorf("want the invalid document reported, got %v", err)
+	}
+}
+
+func TestWait(t *testing.T) {
+	interval, max := resource.PollInterval, resource.MaxPollInterval
+	resource.PollInterval, resource.MaxPollInterval = time.Millisecond, 5*time.Millisecond
+	t.Cleanup(func() { resource.PollInterval, resource.MaxPollInterval = interval, max })
+
+	srv, api := newServer(t)
+	api.Async = []string{"BUILD", "BUILD", "ACTIVE"}
+
+	versions := srv.Count("GET /sda/versions")
+	out, err := run(t, srv, "resourceA", "create", "--name", "w", "--wait", "-o", "jsonpath={.id} {.status}")
+	if err != nil {
+		t.Fatalf("create --wait failed: %s", err)
+	}
+	if n := srv.Count("GET /sda/versions") - versions; n != 1 {
+		t.Errorf("want the endpoint resolved once while polling, got %d versions requests", n)
+	}
+	fields := strings.Fields(out)
+	if len(fields) != 2 || fields[1] != "ACTIVE" {
+		t.Fatalf("want the ready resource printed, got %q", out)
+	}
+	id := fields[0]
+
+	if _, err = run(t, srv, "resourceA", "update", id, "--description", "x"); err != nil {
+		t.Fatalf("update failed: %s", err)
+	}
+	if out, err = run(t, srv, "resourceA", "get", id, "--watch", "-o", "jsonpath={.status}{\"\\n\"}"); err != nil {
+		t.Fatalf("get --watch failed: %s", err)
+	}
+	if got := strings.Fields(out); len(got) != 2 || got[0] != "BUILD" || got[1] != "ACTIVE" {
+		t.Errorf("want each change printed once, got %q", got)
+	}
+
+	if _, err = run(t, srv, "resourceA", "delete", id, "--wait"); err != nil {
+		t.Fatalf("delete --wait failed: %s", err)
+	}
+	if api.Len() != 0 {
+		t.Errorf("resource not gone after delete --wait")
+	}
+
+	api.Async = []string{"BUILD", "ERROR"}
+	_, err = run(t, srv, "resourceA", "create", "--name", "bad", "--wait")
+	if ec, ok := err.(common.ExitCoder); !ok || ec.ExitCode() != common.ExitResourceFailed {
+		t.Errorf("want a failed resource error, got %v", err)
+	}
+
+	api.Async = []string{"BUILD"}
+	_, err = run(t, srv, "resourceA", "create", "--name", "slow", "--wait", "--wait-timeout", "20ms")
+	if ec, ok := err.(common.ExitCoder); !ok || ec.ExitCode() != common.ExitTimeout {
+		t.Errorf("want a wait timeout error, got %v", err)
+	}
+}
+
+func TestBulk(t *testing.T) {
+	srv, api := newServer(t)
+
+	var ids []string
+	for i := 0; i < 6; i++ {
+		out, err := run(t, srv, "resourceA", "create", "--name", fmt.Sprintf("bulk-%d", i), "-o", "jsonpath={.id}")
+		if err != nil {
+			t.Fatalf("create failed: %s", err)
+		}
+		ids = append(ids, strings.TrimSpace(out))
+	}
+
+	versions := srv.Count("GET /sda/versions")
+	args := append([]string{"resourceA", "update", "--description", "old", "--parallel", "3", "-o", "json"}, ids[:4]...)
+	out, err := run(t, srv, args...)
+	if err != nil {
+		t.Fatalf("bulk update failed: %s", err)
+	}
+	if n := srv.Count("GET /sda/versions") - versions; n != 1 {
+		t.Errorf("want the endpoint resolved once for the bulk update, got %d versions requests", n)
+	}
+	var results []map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &results); err != nil || len(results) != 4 {
+		t.Fatalf("want the 4 results as json, got %s", out)
+	}
+	for i, r := range results {
+		if r["id"] != ids[i] || r["result"] != "updated" {
+			t.Errorf("want %s updated, got %v", ids[i], r)
+		}
+	}
+
+	// the missing one fails, the others go on
+	resource.Stdin = strings.NewReader(ids[4] + "\n# a comment\nmissing " + ids[5] + "\n")
+	t.Cleanup(func() { resource.Stdin = os.Stdin })
+	_, err = run(t, srv, "resourceA", "update", "-", "--description", "old", "--continue-on-error")
+	var bulkErr *resource.BulkError
+	if !errors.As(err, &bulkErr) || bulkErr.Failed != 1 || bulkErr.Skipped != 0 || common.ExitCode(err) != common.ExitNotFound {
+		t.Fatalf("want 1 of 3 failed with the not found exit code, got %v", err)
+	}
+	if obj, _ := api.Get(ids[5]); obj["description"] != "old" {
+		t.Errorf("want %s updated after the failed one: %v", ids[5], obj)
+	}
+
+	// the ones after the failure are skipped
+	_, err = run(t, srv, "resourceA", "delete", "--parallel", "1", "missing", ids[0], ids[1])
+	if !errors.As(err, &bulkErr) || bulkErr.Failed != 1 || bulkErr.Skipped != 2 || api.Len() != 6 {
+		t.Fatalf("want the deletes after the failed one skipped, got %v, %d left", err, api.Len())
+	}
+
+	if _, err = run(t, srv, "resourceA", "delete", "--selector", "description=old,name!=bulk-0"); err != nil {
+		t.Fatalf("delete --selector failed: %s", err)
+	}
+	if _, ok := api.Get(ids[0]); !ok || api.Len() != 1 {
+		t.Errorf("want only %s left, %d are", ids[0], api.Len())
+	}
+
+	if _, err = run(t, srv, "resourceA", "delete", "--selector", "name"); err == nil {
+		t.Errorf("want an invalid selector rejected")
+	}
+}
+
+func TestBulkReAuth(t *testing.T) {
+	srv, api := newServer(t)
+
+	var ids []string
+	for i := 0; i < 8; i++ {
+		out, err := run(t, srv, "resourceA", "create", "--name", fmt.Sprintf("reauth-%d", i), "-o", "jsonpath={.id}")
+		if err != nil {
+			t.Fatalf("create failed: %s", err)
+		}
+		ids = append(ids, strings.TrimSpace(out))
+	}
+
+	// the token is revoked once the command resolved the endpoint, so
+	// all the parallel deletes get 401
+	var once sync.Once
+	srv.OnRequest = func(r *http.Request) {
+		if r.URL.Path == "/sda/versions" {
+			once.Do(srv.RevokeAll)
+		}
+	}
+	t.Cleanup(func() { srv.OnRequest = nil })
+
+	auths := srv.Count("POST /v3/auth/tokens")
+	if _, err := run(t, srv, append([]string{"resourceA", "delete", "--parallel", "4"}, ids...)...); err != nil {
+		t.Fatalf("bulk delete failed: %s", err)
+	}
+	if n := srv.Count("POST /v3/auth/tokens") - auths; n != 2 {
+		t.Errorf("want one authentication and one re-authentication, got %d", n)
+	}
+	if api.Len() != 0 {
+		t.Errorf("want all deleted, %d left", api.Len())
+	}
+}
+
+func TestPlugins(t *testing.T) {
+	srv, _ := newServer(t)
+
+	dir, other := t.TempDir(), t.TempDir()
+	script := func(dir, name, body string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, "app-cli-"+name), []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	script(dir, "hello", `echo "$APP_CLI_OUTPUT $APP_CLI_ENDPOINT $APP_CLI_TOKEN" "$@"`)
+	script(dir, "fail", "exit 7")
+	script(dir, "version", "echo plugin")
+	script(dir, "env", `echo "token=$APP_CLI_TOKEN endpoint=$APP_CLI_ENDPOINT"`)
+	script(other, "hello", "echo shadowed")
+	t.Setenv(plugin.DirEnv, dir+string(os.PathListSeparator)+other)
+	addPlugins()
+
+	out, err := run(t, srv, "-o", "json", "hello", "--name", "x", "-o", "y")
+	if err != nil {
+		t.Fatalf("plugin failed: %s", err)
+	}
+	f := strings.Fields(out)
+	if len(f) != 7 || f[0] != "json" || f[1] != srv.URL+"/sda/v1" || f[2] == "" ||
+		strings.Join(f[3:], " ") != "--name x -o y" {
+		t.Errorf("want the settings and the plugin args, got %q", out)
+	}
+
+	// the plugin still runs if the service is not in the catalog
+	out, err = run(t, srv, "--service-name", "missing", "env")
+	if err != nil {
+		t.Fatalf("plugin failed without the service: %s", err)
+	}
+	if !strings.Contains(out, "endpoint=\n") || strings.Contains(out, "token= ") {
+		t.Errorf("want the token and an empty endpoint, got %q", out)
+	}
+
+	_, err = run(t, srv, "fail")
+	if ec, ok := err.(common.ExitCoder); !ok || ec.ExitCode() != 7 {
+		t.Errorf("want the plugin exit code, got %v", err)
+	}
+
+	if out, err = run(t, srv, "version"); err != nil || strings.Contains(out, "plugin") {
+		t.Errorf("want the builtin version run, got %q, %v", out, err)
+	}
+
+	if out, err = run(t, srv, "plugin", "list", "-o", "jsonpath={range .[*]}{.name}: {.status}{\"\\n\"}{end}"); err != nil {
+		t.Fatalf("plugin list failed: %s", err)
+	}
+	for _, want := range []string{
+		"hello: ok", "fail: ok", "env: ok", "version: conflicts with the builtin command version",
+		"hello: shadowed by " + filepath.Join(dir, "app-cli-hello"),
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("plugin list missing %q:\n%s", want, out)
+		}
+	}
+}
+
+// a request hanging until --timeout expires or the cli is interrupted
+func TestTimeoutAndInterrupt(t *testing.T) {
+	srv, _ := newServer(t)
+	started := make(chan struct{}, 1)
+	srv.Handle(resourceA.Path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(func() { common.GlobalFlag.SetContext(nil) })
+
+	stderr := &bytes.Buffer{}
+	start := time.Now()
+	prepare(authArgs(srv, "--timeout", "200ms", "resourceA", "list"))
+	if code := runRoot(context.Background(), stderr); code != common.ExitTimeout {
+		t.Errorf("want exit %d after --timeout, got %d: %s", common.ExitTimeout, code, stderr)
+	}
+	if took := time.Since(start); took > 2*time.Second {
+		t.Errorf("want the request canceled by --timeout, took %s", took)
+	}
+	select {
+	case <-started:
+	default:
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-started
+		cancel()
+	}()
+	stderr.Reset()
+	prepare(authArgs(srv, "resourceA", "list"))
+	if code := runRoot(ctx, stderr); code != ExitInterrupted || strings.TrimSpace(stderr.String()) != "interrupted" {
+		t.Errorf("want exit %d when interrupted, got %d: %s", ExitInterrupted, code, stderr)
+	}
+}
+
+// the signals are released at the first one
+func TestStopOnDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	stopOnDone(ctx, func() { close(stopped) })
+
+	select {
+	case <-stopped:
+		t.Fatal("want the signals caught until ctx is done")
+	case <-time.After(10 * time.Millisecond):
+	}
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Error("want the signals released once ctx is done")
+	}
+}
+
+func TestToken(t *testing.T) {
+	srv, _ := newServer(t)
+
+	out, err := run(t, srv, "token", "issue", "-o", "jsonpath={.id}")
+	if err != nil {
+		t.Fatalf("token issue failed: %s", err)
+	}
+	own := strings.TrimSpace(out)
+	if own == "" {
+		t.Fatal("no token printed")
+	}
+
+	if out, err = run(t, srv, "token", "validate"); err != nil || !strings.Contains(out, "true") {
+		t.Errorf("want the own token valid, got %q, %v", out, err)
+	}
+
+	if out, err = run(t, srv, "token", "show", "-o", "json"); err != nil {
+		t.Fatalf("token show failed: %s", err)
+	}
+	for _, want := range []string{`"name": "member"`, `"name": "` + keystonetest.DefaultProject + `"`, `"catalog"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("token show missing %s:\n%s", want, out)
+		}
+	}
+
+	other := srv.IssueToken("u-alice", "p-demo")
+	if _, err = run(t, srv, "token", "revoke", other); err != nil {
+		t.Fatalf("token revoke failed: %s", err)
+	}
+	if n := srv.Count("DELETE /v3/auth/tokens"); n != 1 {
+		t.Errorf("want 1 revoke request, got %d", n)
+	}
+	if _, err = run(t, srv, "token", "validate", other); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("want a revoked token not valid, got %v", err)
+	}
+}
+
+func TestEndpointCommands(t *testing.T) {
+	srv, _ := newServer(t)
+	srv.Services[0].Endpoints = append(srv.Services[0].Endpoints,
+		keystonetest.Endpoint{ID: "e-internal", Interface: "internal", Region: "RegionTwo", URL: "/internal", Enabled: true})
+
+	for _, noCatalog := range []bool{false, true} {
+		srv.NoCatalog = noCatalog
+
+		out, err := run(t, srv, "catalog", "list", "-o", "json")
+		if err != nil {
+			t.Fatalf("nocatalog=%v: catalog list failed: %s", noCatalog, err)
+		}
+		if !strings.Contains(out, `"name": "`+keystonetest.DefaultService+`"`) || !strings.Contains(out, srv.URL+"/internal") {
+			t.Errorf("nocatalog=%v: catalog list missing the service:\n%s", noCatalog, out)
+		}
+
+		out, err = run(t, srv, "endpoint", "list", "--service", keystonetest.DefaultService, "--interface", "internal", "-o", "jsonpath={range .[*]}{.id} {end}")
+		if err != nil {
+			t.Fatalf("nocatalog=%v: endpoint list failed: %s", noCatalog, err)
+		}
+		if got := strings.TrimSpace(out); got != "e-internal" {
+			t.Errorf("nocatalog=%v: want only the internal endpoint, got %q", noCatalog, got)
+		}
+	}
+
+	out, err := run(t, srv, "endpoint", "show", "-o", "jsonpath={.version_url}")
+	if err != nil {
+		t.Fatalf("endpoint show failed: %s", err)
+	}
+	if want := srv.URL + "/sda/v1"; strings.TrimSpace(out) != want {
+		t.Errorf("want %s, got %s", want, out)
+	}
+
+	out, err = run(t, srv, "endpoint", "show", "--explain", "--os-region-name", "RegionOne")
+	if err != nil {
+		t.Fatalf("endpoint show --explain failed: %s", err)
+	}
+	for _, want := range []string{
+		"1. find the endpoints of the service " + keystonetest.DefaultService,
+		"region RegionOne",
+		"3. read the versions document " + srv.URL + "/sda/versions",
+		"4. the service url is " + srv.URL + "/sda/v1",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("explain missing %q:\n%s", want, out)
+		}
+	}
+
+	if out, err = run(t, srv, "endpoint", "show", "--explain", "--os-region-name", "Nowhere"); err == nil || !strings.Contains(out, "failed: ") {
+		t.Errorf("want the failed step explained, got %v:\n%s", err, out)
+	}
+}
+
+func TestCassette(t *testing.T) {
+	srv, _ := newServer(t)
+	for _, name := range []string{"a", "b"} {
+		if _, err := run(t, srv, "resourceA", "create", "--name", name); err != nil {
+			t.Fatalf("create failed: %s", err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "list.json")
+	want, err := run(t, srv, "resourceA", "list", "-o", "json", "--record", path)
+	if err != nil {
+		t.Fatalf("list --record failed: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), keystonetest.DefaultPassword) || !strings.Contains(string(data), `"***"`) {
+		t.Errorf("want the password and the token redacted:\n%s", data)
+	}
+
+	auths := srv.Count("POST /v3/auth/tokens")
+	got, err := run(t, srv, "resourceA", "list", "-o", "json", "--replay", path)
+	if err != nil {
+		t.Fatalf("list --replay failed: %s", err)
+	}
+	if got != want || srv.Count("POST /v3/auth/tokens") != auths {
+		t.Errorf("want the list replayed without the server, got:\n%s", got)
+	}
+
+	// no credentials nor auth url, the cassette has them
+	got, err = execute(t, "--service-name", keystonetest.DefaultService, "resourceA", "list", "-o", "json", "--replay", path)
+	if err != nil {
+		t.Fatalf("list --replay without credentials failed: %s", err)
+	}
+	if got != want || srv.Count("POST /v3/auth/tokens") != auths {
+		t.Errorf("want the list replayed without credentials, got:\n%s", got)
+	}
+
+	// the version given when recording, so not discovered
+	path2 := filepath.Join(t.TempDir(), "list2.json")
+	if _, err := run(t, srv, "resourceA", "list", "--idenntity-api-version", "3", "--record", path2); err != nil {
+		t.Fatalf("list --record failed: %s", err)
+	}
+	if _, err := execute(t, "--service-name", keystonetest.DefaultService, "resourceA", "list", "--replay", path2); err != nil {
+		t.Errorf("list --replay without credentials nor discovery failed: %s", err)
+	}
+
+	if _, err = run(t, srv, "resourceB", "list", "--replay", path, "--retries", "0"); err == nil || !strings.Contains(err.Error(), "the cassette has no response") {
+		t.Errorf("want the unrecorded request rejected, got %v", err)
+	}
+
+	// the same cassette in a test of the clients
+	c, err := cassette.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	player := cassette.NewPlayer(c)
+	common.HTTPClient.Transport = player
+	t.Cleanup(func() { common.HTTPClient.Transport = nil })
+
+	var listURL string
+	for _, in := range c.Interactions {
+		if strings.HasSuffix(in.Request.URL, "/"+resourceA.Path) {
+			listURL = in.Request.URL
+		}
+	}
+	client, err := common.NewClient(listURL, "any")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.DoRequest(context.Background(), common.Request{URL: listURL, Method: "GET", OkStatusCode: 200})
+	if err != nil || !strings.Contains(string(resp.Body), `"name":"b"`) {
+		t.Errorf("want the recorded list, got %v: %s", err, resp.Body)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	srv, api := newServer(t)
+	id := api.Add(map[string]interface{}{"name": "web", "description": "v1"})
+
+	manifest := filepath.Join(t.TempDir(), "a.yaml")
+	if err := ioutil.WriteFile(manifest, []byte("kind: resourceA\nname: web\ndescription: v2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	api.FailWith = map[string]int{http.MethodPut: http.StatusConflict}
+	_, err := run(t, srv, "apply", "-f", manifest)
+	api.FailWith = nil
+	if got := common.ExitCode(err); got != common.ExitConflict {
+		t.Errorf("apply: want %d for a 409, got %d: %v", common.ExitConflict, got, err)
+	}
+
+	revoked := srv.IssueToken("u-alice", "p-demo")
+	srv.RevokeToken(revoked)
+	_, err = run(t, srv, "token", "validate", revoked)
+	if got := common.ExitCode(err); got != common.ExitNotFound {
+		t.Errorf("token validate: want %d for a revoked token, got %d: %v", common.ExitNotFound, got, err)
+	}
+
+	// a wrong --auth-url is an auth failure, not a missing resource
+	_, err = run(t, srv, "resourceA", "update", id, "--description", "x", "--auth-url", srv.URL+"/missing")
+	var apiErr *apierror.APIError
+	if got := common.ExitCode(err); got != common.ExitAuth || !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("discovery: want %d for a 404, got %d: %v", common.ExitAuth, got, err)
+	}
+	_, err = run(t, srv, "resourceA", "update", id, "--description", "x", "--auth-url", srv.URL+"/missing/v3")
+	if got := common.ExitCode(err); got != common.ExitAuth {
+		t.Errorf("token: want %d for a 404, got %d: %v", common.ExitAuth, got, err)
+	}
+
+	_, err = run(t, srv, "resourceA", "get", id, "--password", "wrong")
+	if got := common.ExitCode(err); got != common.ExitAuth {
+		t.Errorf("auth: want %d for a wrong password, got %d: %v", common.ExitAuth, got, err)
+	}
+
+	for _, code := range []int{common.ExitAuth, common.ExitNotFound, common.ExitConflict, common.ExitTimeout, ExitInterrupted} {
+		if !strings.Contains(RootCmd.Long, fmt.Sprintf("  %d ", code)) {
+			t.Errorf("the root help misses the exit code %d", code)
+		}
+	}
+}
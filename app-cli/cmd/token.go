@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"golang/app-cli/cmd/common"
+	"golang/app-cli/cmd/common/keystone"
+	"golang/app-cli/cmd/common/printer"
+)
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Issue, validate, show and revoke keystone tokens",
+}
+
+var tokenIssueCmd = &cobra.Command{
+	Use:   "issue",
+	Short: "Print the token of the configured credentials and its expiry",
+	Long: `Print the token of the configured credentials and its expiry, the cached
+one if it's still valid, use --no-token-cache for a new one.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := common.GlobalFlag.Authenticate(); err != nil {
+			return err
+		}
+
+		issued := common.GlobalFlag.Issued()
+		obj := map[string]interface{}{
+			"id":         issued.ID,
+			"expires_at": issued.ExpiresAt.Format(time.RFC3339),
+		}
+		if issued.User != nil {
+			obj["user_id"] = issued.User.ID
+		}
+		if issued.Project != nil {
+			obj["project_id"] = issued.Project.ID
+		}
+
+		return common.GlobalFlag.PrintObj(obj, []string{"id", "expires_at", "project_id", "user_id"})
+	},
+}
+
+var tokenValidateCmd = &cobra.Command{
+	Use:   "validate [<token>]",
+	Short: "Check a token is valid, the own one if not given",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		token, err := validateToken(args)
+		if err != nil {
+			return err
+		}
+
+		obj := map[string]interface{}{
+			"id":         token.ID,
+			"valid":      true,
+			"expires_at": token.ExpiresAt.Format(time.RFC3339),
+		}
+		if token.User != nil {
+			obj["user"] = token.User.Name
+		}
+		if token.Project != nil {
+			obj["project"] = token.Project.Name
+		}
+
+		return common.GlobalFlag.PrintObj(obj, []string{"id", "valid", "expires_at", "user", "project"})
+	},
+}
+
+var tokenShowCmd = &cobra.Command{
+	Use:   "show [<token>]",
+	Short: "Show the user, scope, roles and catalog of a token, the own one if not given",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		token, err := validateToken(args)
+		if err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(token)
+		if err != nil {
+			return err
+		}
+		obj, err := printer.Decode(data)
+		if err != nil {
+			return err
+		}
+
+		return common.GlobalFlag.PrintObj(obj, []string{"id", "expires_at", "user.name", "project.name", "domain.name", "roles"})
+	},
+}
+
+var tokenRevokeCmd = &cobra.Command{
+	Use:   "revoke [<token>]",
+	Short: "Revoke a token, the own one if not given",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, subject, err := subjectToken(args)
+		if err != nil {
+			return err
+		}
+
+		if err := client.RevokeToken(common.GlobalFlag.Context(), common.GlobalFlag.GetToken(), subject); err != nil {
+			return err
+		}
+
+		if subject == common.GlobalFlag.Issued().ID && !noTokenCache {
+			tokenCache().Delete(cacheKey(identity, authReq))
+		}
+
+		fmt.Fprintf(common.GlobalFlag.Out(), "token %s revoked\n", subject)
+		return nil
+	},
+}
+
+// subjectToken authenticate, and return the v3 client and the token
+// given in args, the own one if none
+func subjectToken(args []string) (*keystone.Client, string, error) {
+	if len(args) > 1 {
+		return nil, "", errors.New("give one token at most")
+	}
+
+	if err := common.GlobalFlag.Authenticate(); err != nil {
+		return nil, "", err
+	}
+	client, ok := identity.(*keystone.Client)
+	if !ok {
+		return nil, "", fmt.Errorf("the token commands need the identity api v3, not %s", identity.Version())
+	}
+
+	if len(args) == 1 {
+		return client, args[0], nil
+	}
+	return client, common.GlobalFlag.Issued().ID, nil
+}
+
+func validateToken(args []string) (*keystone.Token, error) {
+	client, subject, err := subjectToken(args)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := client.ValidateToken(common.GlobalFlag.Context(), common.GlobalFlag.GetToken(), subject)
+	if err != nil {
+		return nil, fmt.Errorf("validate token: %w", err)
+	}
+	return token, nil
+}
+
+func init() {
+	tokenCmd.AddCommand(tokenIssueCmd, tokenValidateCmd, tokenShowCmd, tokenRevokeCmd)
+	RootCmd.AddCommand(tokenCmd)
+}
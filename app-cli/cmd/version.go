@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"golang/app-cli/cmd/common"
+	"golang/app-cli/version"
+)
+
+// versionCmd print the build info, set by build.sh
+var versionCmd = &cobra.Command{
+	Use:         "version",
+	Short:       "Print the app-cli version",
+	Annotations: noAuth,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := fmt.Fprint(common.GlobalFlag.Out(), version.FullVersion())
+		return err
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(versionCmd)
+}
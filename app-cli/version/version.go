@@ -0,0 +1,19 @@
+package version
+
+import (
+	"fmt"
+)
+
+var (
+	GIT_TAG    string
+	GIT_COMMIT string
+	GIT_BRANCH string
+	BUILD_TIME string
+	GO_VERSION string
+)
+
+// FullVersion show the version info
+func FullVersion() string {
+	version := fmt.Sprintf("Version   : %s\nBuild Time: %s\nGit Branch: %s\nGit Commit: %s\nGo Version: %s\n", GIT_TAG, BUILD_TIME, GIT_BRANCH, GIT_COMMIT, GO_VERSION)
+	return version
+}